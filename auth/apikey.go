@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	helpers "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// APIKeyLivePrefix starts the API keys of the production environment
+	APIKeyLivePrefix = "fk_live_"
+	// APIKeyTestPrefix starts the API keys of the sandbox environment
+	APIKeyTestPrefix = "fk_test_"
+	// APIKeyHeader is the header carrying the API key
+	APIKeyHeader = "X-API-Key"
+	// APIKeyContextKey is the Gin context key holding the authenticated API key
+	APIKeyContextKey = "apiKey"
+)
+
+var (
+	// ErrInvalidAPIKey is returned when an API key is unknown, revoked or malformed
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrAPIKeyExpired is returned when an API key is past its expiry
+	ErrAPIKeyExpired = errors.New("api key expired")
+)
+
+// APIKey is the stored record of an API key. The key itself is only known to its owner
+type APIKey struct {
+	ID         string    `json:"id"`
+	OwnerID    uuid.UUID `json:"ownerID"`
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"`
+	Scopes     []string  `json:"scopes,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt,omitzero"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitzero"`
+}
+
+// Expired reports whether the key is past its expiry. Keys without expiry never expire
+func (k *APIKey) Expired() bool {
+	return !k.ExpiresAt.IsZero() && tokenNow().After(k.ExpiresAt)
+}
+
+// HasScope reports whether the key grants the scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// APIKeyManager generates and authenticates API keys for merchants and internal jobs
+type APIKeyManager struct {
+	store         APIKeyStore
+	prefix        string
+	touchInterval time.Duration
+}
+
+// NewAPIKeyManager creates an API key manager generating keys starting with prefix,
+// APIKeyLivePrefix when empty
+func NewAPIKeyManager(store APIKeyStore, prefix string) *APIKeyManager {
+	if prefix == "" {
+		prefix = APIKeyLivePrefix
+	}
+	return &APIKeyManager{store: store, prefix: prefix, touchInterval: DefaultSessionTouchInterval}
+}
+
+// Create generates an API key for the owner. The key is returned once, only its hash
+// is stored. A zero ttl creates a key that never expires
+func (m *APIKeyManager) Create(ctx context.Context, ownerID uuid.UUID, name string, scopes []string, ttl time.Duration) (string, *APIKey, error) {
+	if ownerID == uuid.Nil {
+		return "", nil, fmt.Errorf("invalid user id")
+	}
+	var secret [32]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+	key := m.prefix + base64.RawURLEncoding.EncodeToString(secret[:])
+
+	now := tokenNow()
+	record := &APIKey{
+		ID:        uuid.NewString(),
+		OwnerID:   ownerID,
+		Name:      name,
+		Prefix:    m.prefix,
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		record.ExpiresAt = now.Add(ttl)
+	}
+	if err := m.store.Save(ctx, hashAPIKey(key), *record, ttl); err != nil {
+		return "", nil, fmt.Errorf("failed to save api key: %w", err)
+	}
+	return key, record, nil
+}
+
+// Authenticate returns the record of the API key and tracks its last use
+func (m *APIKeyManager) Authenticate(ctx context.Context, key string) (*APIKey, error) {
+	if !strings.HasPrefix(key, m.prefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	hash := hashAPIKey(key)
+	record, err := m.store.Get(ctx, hash)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	if record.Expired() {
+		return nil, ErrAPIKeyExpired
+	}
+
+	// The last use is written at most once per interval to spare the store
+	now := tokenNow()
+	if now.Sub(record.LastUsedAt) >= m.touchInterval {
+		if err := m.store.Touch(ctx, hash, now); err != nil {
+			logger.Error(fmt.Sprintf("failed to track api key use: %v", err))
+		}
+		record.LastUsedAt = now
+	}
+	return &record, nil
+}
+
+// Revoke deletes the API key with the given ID
+func (m *APIKeyManager) Revoke(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, id)
+}
+
+// APIKeyGin is a middleware authenticating the X-API-Key header. The owner of the key
+// is stored like AuthGin does so GetUserIDFromGin, RequireScope and RequireAnyScope work
+func APIKeyGin(manager *APIKeyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			c.Abort()
+			helpers.HandleError(c, http.StatusUnauthorized, "Unauthorized", ErrMissingToken)
+			return
+		}
+
+		record, err := manager.Authenticate(c.Request.Context(), key)
+		switch {
+		case errors.Is(err, ErrInvalidAPIKey), errors.Is(err, ErrAPIKeyExpired):
+			c.Abort()
+			helpers.HandleError(c, http.StatusUnauthorized, "Authentication failed", err)
+			return
+		case err != nil:
+			c.Abort()
+			helpers.HandleError(c, http.StatusInternalServerError, "Something went wrong", err)
+			return
+		}
+
+		claims := &CustomClaims{UserID: record.OwnerID, Scopes: record.Scopes}
+		c.Set(UserIDKey, record.OwnerID)
+		c.Set(ClaimsKey, claims)
+		c.Set(APIKeyContextKey, record)
+		c.Request = c.Request.WithContext(ContextWithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// hashAPIKey returns the hex encoded SHA-256 of the key. Keys carry 256 random bits,
+// a fast hash is enough to keep stolen records unusable
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetAPIKeyFromGin retrieves the API key authenticated by APIKeyGin from the Gin context
+func GetAPIKeyFromGin(c *gin.Context) (*APIKey, bool) {
+	value, exists := c.Get(APIKeyContextKey)
+	if !exists {
+		return nil, false
+	}
+	key, ok := value.(*APIKey)
+	return key, ok
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+)
+
+// APIKeyStore persists API keys under the hash of the key
+type APIKeyStore interface {
+	// Save stores the key record under its hash. A zero ttl keeps it until it is deleted
+	Save(ctx context.Context, hash string, key APIKey, ttl time.Duration) error
+	// Get returns the key record stored under the hash, ErrInvalidAPIKey when there is none
+	Get(ctx context.Context, hash string) (APIKey, error)
+	// Touch updates the last use of the key
+	Touch(ctx context.Context, hash string, lastUsedAt time.Time) error
+	// Delete removes the key with the given ID, ErrInvalidAPIKey when there is none
+	Delete(ctx context.Context, id string) error
+}
+
+// RedisAPIKeyStore stores API keys in Redis through the cache package
+type RedisAPIKeyStore struct{}
+
+// NewRedisAPIKeyStore returns an API key store backed by Redis. cache.InitRedis must be called first
+func NewRedisAPIKeyStore() *RedisAPIKeyStore {
+	return &RedisAPIKeyStore{}
+}
+
+func apiKeyKey(hash string) string {
+	return fmt.Sprintf("api_key:%s", hash)
+}
+
+func apiKeyIDKey(id string) string {
+	return fmt.Sprintf("api_key_id:%s", id)
+}
+
+// Save stores the key record under its hash and indexes the hash by key ID
+func (s *RedisAPIKeyStore) Save(ctx context.Context, hash string, key APIKey, ttl time.Duration) error {
+	if err := cache.SetRedisDataTTL(ctx, apiKeyKey(hash), key, ttl); err != nil {
+		return err
+	}
+	return cache.SetRedisDataTTL(ctx, apiKeyIDKey(key.ID), hash, ttl)
+}
+
+// Get returns the key record stored under the hash, ErrInvalidAPIKey when there is none
+func (s *RedisAPIKeyStore) Get(ctx context.Context, hash string) (APIKey, error) {
+	exists, err := cache.ExistsRedisData(ctx, apiKeyKey(hash))
+	if err != nil {
+		return APIKey{}, err
+	}
+	if !exists {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	return cache.GetRedisData[APIKey](ctx, apiKeyKey(hash))
+}
+
+// Touch updates the last use of the key, keeping its expiration
+func (s *RedisAPIKeyStore) Touch(ctx context.Context, hash string, lastUsedAt time.Time) error {
+	key, err := s.Get(ctx, hash)
+	if err != nil {
+		return err
+	}
+	key.LastUsedAt = lastUsedAt
+	return cache.UpdateRedisData(ctx, apiKeyKey(hash), key)
+}
+
+// Delete removes the key with the given ID, ErrInvalidAPIKey when there is none
+func (s *RedisAPIKeyStore) Delete(ctx context.Context, id string) error {
+	exists, err := cache.ExistsRedisData(ctx, apiKeyIDKey(id))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrInvalidAPIKey
+	}
+	hash, err := cache.GetRedisData[string](ctx, apiKeyIDKey(id))
+	if err != nil {
+		return err
+	}
+	if err := cache.DeleteRedisData(ctx, apiKeyKey(hash)); err != nil {
+		return err
+	}
+	return cache.DeleteRedisData(ctx, apiKeyIDKey(id))
+}
+
+// MemoryAPIKeyStore keeps API keys in process memory. It is meant for tests
+type MemoryAPIKeyStore struct {
+	mu     sync.Mutex
+	keys   map[string]APIKey
+	hashes map[string]string
+}
+
+// NewMemoryAPIKeyStore returns an empty in-memory API key store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{
+		keys:   make(map[string]APIKey),
+		hashes: make(map[string]string),
+	}
+}
+
+// Save stores the key record under its hash
+func (s *MemoryAPIKeyStore) Save(_ context.Context, hash string, key APIKey, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[hash] = key
+	s.hashes[key.ID] = hash
+	return nil
+}
+
+// Get returns the key record stored under the hash, ErrInvalidAPIKey when there is none
+func (s *MemoryAPIKeyStore) Get(_ context.Context, hash string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[hash]
+	if !ok {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+// Touch updates the last use of the key
+func (s *MemoryAPIKeyStore) Touch(_ context.Context, hash string, lastUsedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[hash]
+	if !ok {
+		return ErrInvalidAPIKey
+	}
+	key.LastUsedAt = lastUsedAt
+	s.keys[hash] = key
+	return nil
+}
+
+// Delete removes the key with the given ID, ErrInvalidAPIKey when there is none
+func (s *MemoryAPIKeyStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash, ok := s.hashes[id]
+	if !ok {
+		return ErrInvalidAPIKey
+	}
+	delete(s.keys, hash)
+	delete(s.hashes, id)
+	return nil
+}
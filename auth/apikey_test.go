@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveWithAPIKey(t *testing.T, manager *APIKeyManager, key string, guards ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(APIKeyGin(manager))
+	r.Use(guards...)
+	r.GET("/test", func(c *gin.Context) {
+		apiKey, ok := GetAPIKeyFromGin(c)
+		assert.True(t, ok)
+		assert.Equal(t, GetUserIDFromGin(c), apiKey.OwnerID)
+		c.Status(200)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyManager(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	manager := NewAPIKeyManager(store, "")
+
+	key, record, err := manager.Create(ctx, userID, "Merchant checkout", []string{"payment:create"}, 0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, APIKeyLivePrefix))
+	assert.True(t, record.ExpiresAt.IsZero(), "keys without ttl never expire")
+
+	stored, err := store.Get(ctx, hashAPIKey(key))
+	require.NoError(t, err)
+	assert.Equal(t, record.ID, stored.ID)
+	assert.NotContains(t, stored.Name+stored.ID+stored.Prefix, key[len(APIKeyLivePrefix):], "only the hash is stored")
+
+	authenticated, err := manager.Authenticate(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, userID, authenticated.OwnerID)
+	assert.True(t, authenticated.HasScope("payment:create"))
+
+	stored, err = store.Get(ctx, hashAPIKey(key))
+	require.NoError(t, err)
+	assert.False(t, stored.LastUsedAt.IsZero(), "last use is tracked")
+
+	_, err = manager.Authenticate(ctx, key+"x")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = manager.Authenticate(ctx, "fk_test_"+key[len(APIKeyLivePrefix):])
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	require.NoError(t, manager.Revoke(ctx, record.ID))
+	_, err = manager.Authenticate(ctx, key)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	assert.ErrorIs(t, manager.Revoke(ctx, record.ID), ErrInvalidAPIKey)
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	manager := NewAPIKeyManager(store, APIKeyTestPrefix)
+
+	key, record, err := manager.Create(ctx, userID, "Nightly job", nil, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, APIKeyTestPrefix))
+
+	record.ExpiresAt = time.Now().Add(-time.Second)
+	require.NoError(t, store.Save(ctx, hashAPIKey(key), *record, 0))
+	_, err = manager.Authenticate(ctx, key)
+	assert.ErrorIs(t, err, ErrAPIKeyExpired)
+}
+
+func TestAPIKeyGin(t *testing.T) {
+	ctx := context.Background()
+	manager := NewAPIKeyManager(NewMemoryAPIKeyStore(), "")
+	key, _, err := manager.Create(ctx, userID, "Merchant checkout", []string{"payment:create"}, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, serveWithAPIKey(t, manager, key).Code)
+	assert.Equal(t, http.StatusOK, serveWithAPIKey(t, manager, key, RequireScope("payment:create")).Code)
+	assert.Equal(t, http.StatusForbidden, serveWithAPIKey(t, manager, key, RequireScope("wallet:withdraw")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serveWithAPIKey(t, manager, "").Code)
+
+	w := serveWithAPIKey(t, manager, "fk_live_unknown")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"message":"Authentication failed","success":false}`, w.Body.String())
+}
@@ -1,52 +1,330 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 
+	helpers "github.com/emmadal/feeti-module/status"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+const (
+	// UserIDKey is the default Gin context key holding the authenticated user ID
+	UserIDKey = "userID"
+	// ClaimsKey is the Gin context key holding the claims of the authenticated token
+	ClaimsKey = "claims"
+)
+
+var (
+	// ErrMissingToken is returned when the request carries no token
+	ErrMissingToken = errors.New("missing token")
+	// ErrInvalidToken is returned when the token cannot be verified
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenRevoked is returned when the token has been revoked
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrAuthMisconfigured is returned when the middleware has no way to verify tokens
+	ErrAuthMisconfigured = errors.New("authentication is not configured")
+)
+
+// UnauthorizedHandler writes the response of a rejected request. The handler must abort the context
+type UnauthorizedHandler func(c *gin.Context, status int, err error)
+
+// AuthOption configures the middleware returned by NewAuthGin
+type AuthOption func(*authConfig)
+
+type authConfig struct {
+	verifier       Verifier
+	extractors     []TokenExtractor
+	cookieName     string
+	contextKey     string
+	onUnauthorized UnauthorizedHandler
+	optional       bool
+	revocations    RevocationStore
+	hasRevocations bool
+	sessions       *SessionRegistry
+	renewal        *RenewalConfig
+	// impersonationPolicy and auditImpersonation apply to impersonation tokens
+	impersonationPolicy ImpersonationPolicy
+	auditImpersonation  ImpersonationAuditor
+	// onHTTPUnauthorized replaces onUnauthorized in the net/http middleware
+	onHTTPUnauthorized HTTPUnauthorizedHandler
+}
+
+// WithSecretKey verifies HS256 tokens signed with the secret key
+func WithSecretKey(secretKey []byte) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.verifier = nil
+		if len(secretKey) > 0 {
+			cfg.verifier = newHMACKey(secretKey)
+		}
+	}
+}
+
+// WithVerifier verifies tokens with the verifier, e.g. a public key or a keyring
+func WithVerifier(verifier Verifier) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.verifier = verifier
+	}
+}
+
+// WithTokenExtractors looks for the token with each extractor in turn, the first token found is used
+func WithTokenExtractors(extractors ...TokenExtractor) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.extractors = extractors
+	}
+}
+
+// WithCookieName reads the token from the named cookie instead of ftk when no extractors are set
+func WithCookieName(name string) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.cookieName = name
+	}
+}
+
+// WithContextKey stores the user ID under key in the Gin context instead of UserIDKey
+func WithContextKey(key string) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.contextKey = key
+	}
+}
+
+// WithUnauthorizedHandler replaces the default error response of the middleware
+func WithUnauthorizedHandler(handler UnauthorizedHandler) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.onUnauthorized = handler
+	}
+}
+
+// WithOptional lets requests without token through anonymously. Invalid tokens are still rejected
+func WithOptional() AuthOption {
+	return func(cfg *authConfig) {
+		cfg.optional = true
+	}
+}
+
+// WithRevocationStore checks revocations in store instead of the store set by UseRevocationStore
+func WithRevocationStore(store RevocationStore) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.revocations = store
+		cfg.hasRevocations = true
+	}
+}
+
+// WithSessionRegistry rejects tokens whose session has been revoked and refreshes the
+// last-seen time of the session. Tokens without session ID are not checked
+func WithSessionRegistry(registry *SessionRegistry) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.sessions = registry
+	}
+}
+
 // AuthGin is a middleware that checks if the user is authenticated for a Gin framework
 func AuthGin(secretKey []byte) gin.HandlerFunc {
+	return NewAuthGin(WithSecretKey(secretKey))
+}
+
+// AuthGinWithVerifier is a middleware that checks if the user is authenticated,
+// verifying the token with the given verifier, e.g. a public key
+func AuthGinWithVerifier(verifier Verifier) gin.HandlerFunc {
+	return NewAuthGin(WithVerifier(verifier))
+}
+
+// NewAuthGin is a configurable middleware that checks if the user is authenticated.
+// By default the token is read from the ftk cookie and errors use the status package envelope.
+func NewAuthGin(opts ...AuthOption) gin.HandlerFunc {
+	cfg := newAuthConfig(opts)
+
 	return func(c *gin.Context) {
-		// Validate secret key
-		if len(secretKey) == 0 {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
+		claims, status, err := cfg.authenticate(c.Request)
+		if err != nil {
+			cfg.onUnauthorized(c, status, err)
 			return
 		}
-
-		// Get the token from the cookie
-		tokenCookie, err := c.Request.Cookie("ftk")
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		if claims == nil {
+			// Anonymous request let through by WithOptional
+			c.Next()
 			return
 		}
 
-		// Verify if the token is empty
-		if tokenCookie.Value == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Missing token"})
-			return
+		// Renew tokens about to expire when sliding renewal is enabled
+		if cfg.renewal != nil {
+			cfg.renewToken(c.Writer, c.Request, claims)
 		}
+		cfg.serveGin(c, claims)
+	}
+}
 
-		// Verify the token
-		userID, err := VerifyToken(tokenCookie.Value, secretKey)
+// serveGin attaches the user ID and claims to the gin context and to the request
+// context, then runs the next handlers
+func (cfg *authConfig) serveGin(c *gin.Context, claims *CustomClaims) {
+	c.Set(cfg.contextKey, claims.UserID)
+	c.Set(ClaimsKey, claims)
+	c.Request = c.Request.WithContext(ContextWithClaims(c.Request.Context(), claims))
+
+	// Record every request served under impersonation, even when a handler panics
+	if claims.IsImpersonated() {
+		defer func() {
+			if err := recover(); err != nil {
+				cfg.audit(c.Request, claims, http.StatusInternalServerError)
+				panic(err)
+			}
+			cfg.audit(c.Request, claims, c.Writer.Status())
+		}()
+	}
+	c.Next()
+}
+
+func newAuthConfig(opts []AuthOption) *authConfig {
+	cfg := &authConfig{
+		cookieName:          AuthCookieName,
+		contextKey:          UserIDKey,
+		onUnauthorized:      defaultUnauthorizedHandler,
+		onHTTPUnauthorized:  defaultHTTPUnauthorizedHandler,
+		impersonationPolicy: ReadOnlyImpersonation,
+		auditImpersonation:  defaultImpersonationAuditor,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.extractors == nil {
+		cfg.extractors = []TokenExtractor{FromCookie(cfg.cookieName)}
+	}
+	return cfg
+}
+
+// authenticate runs the checks shared by the Gin and net/http middleware. It returns the
+// claims of the token, or nil claims and no error for an anonymous optional request.
+// On failure it returns the status to respond with.
+func (cfg *authConfig) authenticate(r *http.Request) (*CustomClaims, int, error) {
+	// Validate verifier
+	if cfg.verifier == nil {
+		return nil, http.StatusInternalServerError, ErrAuthMisconfigured
+	}
+
+	// Get the token from the request
+	token := extractToken(r, cfg.extractors)
+	if token == "" {
+		if cfg.optional {
+			return nil, 0, nil
+		}
+		return nil, http.StatusUnauthorized, ErrMissingToken
+	}
+
+	// Verify the token
+	claims, err := VerifyTokenClaims(token, cfg.verifier)
+	if err != nil {
+		return nil, http.StatusUnauthorized, ErrInvalidToken
+	}
+	if status, err := cfg.checkClaims(r, claims); err != nil {
+		return nil, status, err
+	}
+	return claims, 0, nil
+}
+
+// checkClaims rejects revoked tokens and sessions and applies the impersonation policy
+// to verified claims. On failure it returns the status to respond with.
+func (cfg *authConfig) checkClaims(r *http.Request, claims *CustomClaims) (int, error) {
+	// Reject revoked tokens when a revocation store is configured
+	store := cfg.revocations
+	if !cfg.hasRevocations {
+		store = getRevocationStore()
+	}
+	if store != nil {
+		revoked, err := IsTokenRevoked(r.Context(), store, claims)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Authentication failed"})
-			return
+			return http.StatusInternalServerError, err
+		}
+		if revoked {
+			return http.StatusUnauthorized, ErrTokenRevoked
+		}
+	}
+
+	// Reject revoked sessions when a session registry is configured
+	if cfg.sessions != nil && claims.SessionID != "" {
+		err := cfg.sessions.Touch(r.Context(), claims.UserID, claims.SessionID)
+		if errors.Is(err, ErrSessionNotFound) {
+			return http.StatusUnauthorized, ErrSessionRevoked
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
 		}
+	}
+
+	// Restrict the requests of impersonation tokens, rejections are audited too
+	if err := cfg.authorizeImpersonation(r, claims); err != nil {
+		cfg.audit(r, claims, http.StatusForbidden)
+		return http.StatusForbidden, err
+	}
+	return 0, nil
+}
+
+// defaultUnauthorizedHandler aborts with the status package envelope
+func defaultUnauthorizedHandler(c *gin.Context, status int, err error) {
+	c.Abort()
+	helpers.HandleError(c, status, unauthorizedMessage(status, err), err)
+}
 
-		// Attach userID to the gin context
-		c.Set("userID", userID)
-		c.Next()
+// unauthorizedMessage returns the message of the error envelope of a rejected request
+func unauthorizedMessage(status int, err error) string {
+	switch {
+	case status == http.StatusInternalServerError:
+		return "Something went wrong"
+	case errors.Is(err, ErrMissingToken):
+		return "Unauthorized"
+	case errors.Is(err, ErrTokenRevoked):
+		return "Token revoked"
+	case errors.Is(err, ErrSessionRevoked):
+		return "Session revoked"
+	case errors.Is(err, ErrImpersonationForbidden):
+		return "Not allowed while impersonating"
+	default:
+		return "Authentication failed"
 	}
 }
 
 // GetUserIDFromGin retrieves the user ID from the Gin context
 func GetUserIDFromGin(c *gin.Context) uuid.UUID {
-	userID, exists := c.Get("userID")
+	return GetUserIDFromGinKey(c, UserIDKey)
+}
+
+// GetClaimsFromGin retrieves the claims of the authenticated token from the Gin context
+func GetClaimsFromGin(c *gin.Context) (*CustomClaims, bool) {
+	value, exists := c.Get(ClaimsKey)
 	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*CustomClaims)
+	return claims, ok
+}
+
+// GetRolesFromGin retrieves the roles of the authenticated user from the Gin context
+func GetRolesFromGin(c *gin.Context) []string {
+	claims, ok := GetClaimsFromGin(c)
+	if !ok {
+		return nil
+	}
+	return claims.Roles
+}
+
+// GetScopesFromGin retrieves the scopes of the authenticated token from the Gin context
+func GetScopesFromGin(c *gin.Context) []string {
+	claims, ok := GetClaimsFromGin(c)
+	if !ok {
+		return nil
+	}
+	return claims.Scopes
+}
+
+// GetUserIDFromGinKey retrieves the user ID stored under a custom context key
+func GetUserIDFromGinKey(c *gin.Context, key string) uuid.UUID {
+	userID, exists := c.Get(key)
+	if !exists {
+		return uuid.Nil
+	}
+	id, ok := userID.(uuid.UUID)
+	if !ok {
 		return uuid.Nil
 	}
-	return userID.(uuid.UUID)
+	return id
 }
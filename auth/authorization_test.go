@@ -115,3 +115,205 @@ func TestGetUserIDFromGin(t *testing.T) {
 		c.JSON(200, gin.H{"userID": userID})
 	})
 }
+
+func TestAuthGinWithVerifier(t *testing.T) {
+	key, err := NewSigningKey(generateTestSigners(t)["EdDSA"])
+	assert.NoError(t, err)
+	validToken, err := GenerateTokenWithSigner(userID, key)
+	assert.NoError(t, err)
+	hmacToken, err := GenerateToken(userID, secretKey)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		verifier       Verifier
+		token          string
+		expectedStatus int
+	}{
+		{name: "Valid token", verifier: key.Public(), token: validToken, expectedStatus: 200},
+		{name: "Token signed with another key", verifier: key.Public(), token: hmacToken, expectedStatus: 401},
+		{name: "Missing verifier", verifier: nil, token: validToken, expectedStatus: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(AuthGinWithVerifier(tt.verifier))
+			r.GET("/test", func(c *gin.Context) {
+				assert.Equal(t, userID, GetUserIDFromGin(c))
+				c.JSON(200, gin.H{"message": "success"})
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+			req.AddCookie(&http.Cookie{Name: "ftk", Value: tt.token, Path: "/"})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestNewAuthGinTokenSources(t *testing.T) {
+	validToken, err := GenerateToken(userID, secretKey)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		opts           []AuthOption
+		setup          func(req *http.Request)
+		expectedStatus int
+	}{
+		{
+			name: "Bearer header",
+			opts: []AuthOption{WithTokenExtractors(FromBearer(), FromCookie(AuthCookieName))},
+			setup: func(req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+validToken)
+			},
+			expectedStatus: 200,
+		},
+		{
+			name: "Cookie fallback",
+			opts: []AuthOption{WithTokenExtractors(FromBearer(), FromCookie(AuthCookieName))},
+			setup: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: validToken})
+			},
+			expectedStatus: 200,
+		},
+		{
+			name: "Wrong scheme",
+			opts: []AuthOption{WithTokenExtractors(FromBearer())},
+			setup: func(req *http.Request) {
+				req.Header.Set("Authorization", "Basic "+validToken)
+			},
+			expectedStatus: 401,
+		},
+		{
+			name: "Custom header",
+			opts: []AuthOption{WithTokenExtractors(FromHeader("X-Partner-Token"))},
+			setup: func(req *http.Request) {
+				req.Header.Set("X-Partner-Token", validToken)
+			},
+			expectedStatus: 200,
+		},
+		{
+			name: "Custom cookie name",
+			opts: []AuthOption{WithCookieName("session")},
+			setup: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: "session", Value: validToken})
+			},
+			expectedStatus: 200,
+		},
+		{
+			name: "Default cookie ignored with custom name",
+			opts: []AuthOption{WithCookieName("session")},
+			setup: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: validToken})
+			},
+			expectedStatus: 401,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(NewAuthGin(append([]AuthOption{WithSecretKey(secretKey)}, tt.opts...)...))
+			r.GET("/test", func(c *gin.Context) {
+				assert.Equal(t, userID, GetUserIDFromGin(c))
+				c.JSON(200, gin.H{"message": "success"})
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestNewAuthGinErrorEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthGin(secretKey))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"message": "success"})
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"message":"Unauthorized","success":false}`, w.Body.String())
+}
+
+func TestNewAuthGinContextKeyAndHandler(t *testing.T) {
+	validToken, err := GenerateToken(userID, secretKey)
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewAuthGin(
+		WithSecretKey(secretKey),
+		WithContextKey("accountID"),
+		WithUnauthorizedHandler(func(c *gin.Context, status int, err error) {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		}),
+	))
+	r.GET("/test", func(c *gin.Context) {
+		assert.Equal(t, uuid.Nil, GetUserIDFromGin(c))
+		assert.Equal(t, userID, GetUserIDFromGinKey(c, "accountID"))
+		c.JSON(200, gin.H{"message": "success"})
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: validToken})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: "invalid_token"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error":"invalid token"}`, w.Body.String())
+}
+
+func TestNewAuthGinOptional(t *testing.T) {
+	validToken, err := GenerateToken(userID, secretKey)
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewAuthGin(WithSecretKey(secretKey), WithOptional()))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"userID": GetUserIDFromGin(c)})
+	})
+
+	// Anonymous request
+	req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), uuid.Nil.String())
+
+	// Authenticated request
+	req, _ = http.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: validToken})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), userID.String())
+
+	// Invalid tokens are still rejected
+	req, _ = http.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: "invalid_token"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
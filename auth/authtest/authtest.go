@@ -0,0 +1,152 @@
+// Package authtest provides helpers to test the services using the auth package: it
+// mints valid, expired, wrongly-signed and tampered tokens, builds requests carrying
+// them, fakes the clock and injects a chosen principal in the Gin context.
+package authtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emmadal/feeti-module/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SecretKey is the secret key of the tokens minted by NewMinter when none is given
+var SecretKey = []byte("authtest_secret_key")
+
+// Minter mints tokens for tests. Its clock, when set, decides their issue and expiry times
+type Minter struct {
+	key   *auth.Key
+	clock *Clock
+}
+
+// NewMinter returns a minter signing HS256 tokens with the secret key, SecretKey when empty
+func NewMinter(secretKey []byte) *Minter {
+	if len(secretKey) == 0 {
+		secretKey = SecretKey
+	}
+	key, _ := auth.NewHMACKey(secretKey)
+	return &Minter{key: key}
+}
+
+// WithClock returns a copy of the minter issuing tokens at the time of the clock
+func (m *Minter) WithClock(clock *Clock) *Minter {
+	return &Minter{key: m.key, clock: clock}
+}
+
+// Key returns the key of the minter, e.g. for auth.WithVerifier
+func (m *Minter) Key() *auth.Key {
+	return m.key
+}
+
+// Token mints a valid token for the user
+func (m *Minter) Token(t testing.TB, userID uuid.UUID, opts ...auth.ClaimsOption) string {
+	t.Helper()
+	now := m.now()
+	return m.mint(t, m.key, userID, append([]auth.ClaimsOption{issuedAt(now, now.Add(auth.DefaultTokenTTL))}, opts...))
+}
+
+// ExpiredToken mints a token for the user that expired an hour ago
+func (m *Minter) ExpiredToken(t testing.TB, userID uuid.UUID, opts ...auth.ClaimsOption) string {
+	t.Helper()
+	now := m.now()
+	return m.mint(t, m.key, userID, append([]auth.ClaimsOption{issuedAt(now.Add(-2*time.Hour), now.Add(-time.Hour))}, opts...))
+}
+
+// WrongSignatureToken mints a token for the user signed with another secret key
+func (m *Minter) WrongSignatureToken(t testing.TB, userID uuid.UUID, opts ...auth.ClaimsOption) string {
+	t.Helper()
+	key, _ := auth.NewHMACKey([]byte("authtest_wrong_secret_key"))
+	now := m.now()
+	return m.mint(t, key, userID, append([]auth.ClaimsOption{issuedAt(now, now.Add(auth.DefaultTokenTTL))}, opts...))
+}
+
+// TamperedToken mints a valid token for the user, then swaps its user ID for another one
+// while keeping the original signature
+func (m *Minter) TamperedToken(t testing.TB, userID uuid.UUID, opts ...auth.ClaimsOption) string {
+	t.Helper()
+	parts := strings.Split(m.Token(t, userID, opts...), ".")
+	if len(parts) != 3 {
+		t.Fatalf("authtest: cannot tamper with an encrypted token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("authtest: failed to decode token: %v", err)
+	}
+	claims := map[string]any{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("authtest: failed to decode token: %v", err)
+	}
+	claims["userID"] = uuid.NewString()
+	if payload, err = json.Marshal(claims); err != nil {
+		t.Fatalf("authtest: failed to encode token: %v", err)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	return strings.Join(parts, ".")
+}
+
+func (m *Minter) mint(t testing.TB, key *auth.Key, userID uuid.UUID, opts []auth.ClaimsOption) string {
+	t.Helper()
+	token, err := auth.GenerateTokenWithSigner(userID, key, opts...)
+	if err != nil {
+		t.Fatalf("authtest: failed to mint token: %v", err)
+	}
+	return token
+}
+
+func (m *Minter) now() time.Time {
+	if m.clock != nil {
+		return m.clock.Now()
+	}
+	return time.Now()
+}
+
+// issuedAt sets the issue and expiry times of the token
+func issuedAt(iat, exp time.Time) auth.ClaimsOption {
+	return func(claims *auth.CustomClaims) {
+		claims.IssuedAt = jwt.NewNumericDate(iat)
+		claims.NotBefore = jwt.NewNumericDate(iat)
+		claims.ExpiresAt = jwt.NewNumericDate(exp)
+	}
+}
+
+// NewRequest returns a request carrying the token in the ftk cookie, as browsers send it
+func NewRequest(method, target, token string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.AddCookie(&http.Cookie{Name: auth.AuthCookieName, Value: token})
+	return req
+}
+
+// NewBearerRequest returns a request carrying the token in the Authorization header, as the mobile apps send it
+func NewBearerRequest(method, target, token string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// AsUser is a middleware authenticating every request as the user, in place of AuthGin.
+// Roles, scopes and other claims are set with the auth.ClaimsOption functions
+func AsUser(userID uuid.UUID, opts ...auth.ClaimsOption) gin.HandlerFunc {
+	claims := &auth.CustomClaims{UserID: userID}
+	for _, opt := range opts {
+		opt(claims)
+	}
+	return AsClaims(claims)
+}
+
+// AsClaims is a middleware authenticating every request with the claims, in place of AuthGin
+func AsClaims(claims *auth.CustomClaims) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(auth.UserIDKey, claims.UserID)
+		c.Set(auth.ClaimsKey, claims)
+		c.Request = c.Request.WithContext(auth.ContextWithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
@@ -0,0 +1,82 @@
+package authtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emmadal/feeti-module/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter(middleware gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware)
+	r.Any("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, auth.GetUserIDFromGin(c).String())
+	})
+	return r
+}
+
+func TestMinter(t *testing.T) {
+	userID := uuid.New()
+	minter := NewMinter(nil)
+	r := newTestRouter(auth.AuthGin(SecretKey))
+
+	tests := []struct {
+		name           string
+		req            *http.Request
+		expectedStatus int
+	}{
+		{"Valid token in cookie", NewRequest(http.MethodGet, "/test", minter.Token(t, userID)), http.StatusOK},
+		{"Expired token", NewRequest(http.MethodGet, "/test", minter.ExpiredToken(t, userID)), http.StatusUnauthorized},
+		{"Wrongly-signed token", NewRequest(http.MethodGet, "/test", minter.WrongSignatureToken(t, userID)), http.StatusUnauthorized},
+		{"Tampered token", NewRequest(http.MethodGet, "/test", minter.TamperedToken(t, userID)), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, tt.req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, userID.String(), w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewBearerRequest(t *testing.T) {
+	userID := uuid.New()
+	minter := NewMinter([]byte("service_secret_key"))
+	r := newTestRouter(auth.NewAuthGin(auth.WithVerifier(minter.Key()), auth.WithTokenExtractors(auth.FromBearer())))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, NewBearerRequest(http.MethodPost, "/test", minter.Token(t, userID, auth.WithRoles("admin"))))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, userID.String(), w.Body.String())
+}
+
+func TestAsUser(t *testing.T) {
+	userID := uuid.New()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin", AsUser(userID, auth.WithRoles("admin")), auth.RequireRole("admin"), func(c *gin.Context) {
+		assert.Equal(t, userID, auth.GetUserIDFromGin(c))
+		assert.Equal(t, userID, auth.UserIDFromContext(c.Request.Context()))
+		c.Status(http.StatusOK)
+	})
+	r.GET("/support", AsUser(userID), auth.RequireRole("admin"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/support", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
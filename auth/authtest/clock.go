@@ -0,0 +1,54 @@
+package authtest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emmadal/feeti-module/auth"
+)
+
+// Clock is a fake clock only moving when told to
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at the given time
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to the given time
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// UseClock makes the auth package run at the time of the clock with the token config,
+// see TokenConfig.Now for what follows the clock. The previous token config is restored
+// when the test ends
+func UseClock(t testing.TB, clock *Clock, cfg auth.TokenConfig) {
+	t.Helper()
+	previous := auth.CurrentTokenConfig()
+	cfg.Now = clock.Now
+	if err := auth.UseTokenConfig(cfg); err != nil {
+		t.Fatalf("authtest: invalid token config: %v", err)
+	}
+	t.Cleanup(func() { _ = auth.UseTokenConfig(previous) })
+}
@@ -0,0 +1,89 @@
+package authtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emmadal/feeti-module/auth"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+}
+
+func TestUseClock(t *testing.T) {
+	clock := NewClock(time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC))
+	UseClock(t, clock, auth.TokenConfig{TTL: 10 * time.Minute})
+
+	userID := uuid.New()
+	token, err := auth.GenerateToken(userID, SecretKey)
+	assert.NoError(t, err)
+	r := newTestRouter(auth.AuthGin(SecretKey))
+	serve := func(token string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, NewRequest(http.MethodGet, "/test", token))
+		return w.Code
+	}
+
+	// The token issued in 2025 is valid at the time of the clock
+	assert.Equal(t, http.StatusOK, serve(token))
+	clock.Advance(9 * time.Minute)
+	assert.Equal(t, http.StatusOK, serve(token))
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, http.StatusUnauthorized, serve(token))
+
+	// The minter follows the clock too
+	assert.Equal(t, http.StatusOK, serve(NewMinter(nil).WithClock(clock).Token(t, userID)))
+}
+
+func TestUseClockRestoresTokenConfig(t *testing.T) {
+	previous := auth.TokenConfig{TTL: time.Hour, Issuer: "feeti"}
+	assert.NoError(t, auth.UseTokenConfig(previous))
+	t.Cleanup(func() { _ = auth.UseTokenConfig(auth.TokenConfig{}) })
+
+	t.Run("clock", func(t *testing.T) {
+		UseClock(t, NewClock(time.Now()), auth.TokenConfig{TTL: time.Minute})
+		assert.Equal(t, time.Minute, auth.CurrentTokenConfig().TTL)
+	})
+
+	cfg := auth.CurrentTokenConfig()
+	assert.Equal(t, time.Hour, cfg.TTL)
+	assert.Equal(t, "feeti", cfg.Issuer)
+	assert.Nil(t, cfg.Now)
+}
+
+func TestUseClockReachesStores(t *testing.T) {
+	clock := NewClock(time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC))
+	UseClock(t, clock, auth.TokenConfig{})
+	ctx := context.Background()
+
+	// Tickets expire at the time of the clock
+	tickets := auth.NewTicketManager(auth.NewMemoryTicketStore(), time.Minute)
+	ticket, err := tickets.Issue(ctx, &auth.CustomClaims{UserID: uuid.New()})
+	require.NoError(t, err)
+	clock.Advance(2 * time.Minute)
+	_, err = tickets.Redeem(ctx, ticket)
+	assert.Error(t, err)
+
+	// So do API keys
+	keys := auth.NewAPIKeyManager(auth.NewMemoryAPIKeyStore(), "fk")
+	_, key, err := keys.Create(ctx, uuid.New(), "ci", nil, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, key.Expired())
+	clock.Advance(2 * time.Hour)
+	assert.True(t, key.Expired())
+}
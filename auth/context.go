@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// contextKey is the type of the keys set by the package in a context.Context
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// ContextWithClaims returns a copy of ctx carrying the claims of the authenticated token
+func ContextWithClaims(ctx context.Context, claims *CustomClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// ClaimsFromContext retrieves the claims of the authenticated token from the context
+func ClaimsFromContext(ctx context.Context) (*CustomClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*CustomClaims)
+	return claims, ok && claims != nil
+}
+
+// UserIDFromContext retrieves the authenticated user ID from the context, uuid.Nil when there is none
+func UserIDFromContext(ctx context.Context) uuid.UUID {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return uuid.Nil
+	}
+	return claims.UserID
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,26 +10,89 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// CustomClaims defines the claims of the tokens issued by the module.
+// RegisteredClaims.ID carries the jti used to revoke a single token.
 type CustomClaims struct {
-	UserID uuid.UUID `json:"userID"`
+	UserID    uuid.UUID `json:"userID"`
+	Roles     []string  `json:"roles,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	SessionID string    `json:"sid,omitempty"`
+	// SessionExpiresAt bounds the sliding renewal of the token, see WithSlidingRenewal
+	SessionExpiresAt *jwt.NumericDate `json:"sexp,omitempty"`
+	// AuthMethods lists how the user authenticated, e.g. "pwd" then "otp" after a step-up
+	AuthMethods []string `json:"amr,omitempty"`
+	// AuthTime is when the user logged in
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// StepUpAt is when the user last confirmed a second factor, see RequireStepUp
+	StepUpAt *jwt.NumericDate `json:"stepup_at,omitempty"`
+	// Actor is the admin using the token on behalf of the user, see GenerateImpersonationToken
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generate a valid jwt token for 30 minutes
-func GenerateToken(userID uuid.UUID, secretKey []byte) (string, error) {
+// ClaimsOption adds optional claims to a generated token
+type ClaimsOption func(*CustomClaims)
+
+// WithRoles adds roles to the token, e.g. "admin"
+func WithRoles(roles ...string) ClaimsOption {
+	return func(claims *CustomClaims) {
+		claims.Roles = append(claims.Roles, roles...)
+	}
+}
+
+// WithScopes adds scopes to the token, e.g. "wallet:withdraw"
+func WithScopes(scopes ...string) ClaimsOption {
+	return func(claims *CustomClaims) {
+		claims.Scopes = append(claims.Scopes, scopes...)
+	}
+}
+
+// WithSessionID binds the token to a session of the SessionRegistry
+func WithSessionID(sessionID string) ClaimsOption {
+	return func(claims *CustomClaims) {
+		claims.SessionID = sessionID
+	}
+}
+
+// WithSessionExpiry sets the absolute time after which the token can no longer be renewed
+func WithSessionExpiry(expiresAt time.Time) ClaimsOption {
+	return func(claims *CustomClaims) {
+		claims.SessionExpiresAt = jwt.NewNumericDate(expiresAt)
+	}
+}
+
+// GenerateToken generate a valid jwt token for the TokenConfig TTL, 30 minutes by default
+func GenerateToken(userID uuid.UUID, secretKey []byte, opts ...ClaimsOption) (string, error) {
 	// check if the secret key and userID are valid
 	if len(secretKey) == 0 || userID == uuid.Nil {
 		return "", fmt.Errorf("invalid user id")
 	}
+	return GenerateTokenWithSigner(userID, newHMACKey(secretKey), opts...)
+}
+
+// GenerateTokenWithSigner generate a valid jwt token for the TokenConfig TTL signed by the given signer
+func GenerateTokenWithSigner(userID uuid.UUID, signer Signer, opts ...ClaimsOption) (string, error) {
+	// check if the signer and userID are valid
+	if signer == nil || userID == uuid.Nil {
+		return "", fmt.Errorf("invalid user id")
+	}
 	// create a new token with the given userID
-	now := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(30 * time.Minute)),
-		},
-	})
-	// sign the token with the secret key
-	return token.SignedString(secretKey)
+	claims := CustomClaims{
+		UserID:           userID,
+		RegisteredClaims: newRegisteredClaims(tokenNow()),
+	}
+	for _, opt := range opts {
+		opt(&claims)
+	}
+	return signer.Sign(claims)
+}
+
+// HasRole reports whether the claims carry the role
+func (c *CustomClaims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// HasScope reports whether the claims carry the scope
+func (c *CustomClaims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
 }
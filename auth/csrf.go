@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	helpers "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// CSRFCookieName is the name of the cookie holding the CSRF token. It is readable by JavaScript
+	CSRFCookieName = "fcsrf"
+	// CSRFHeaderName is the header in which clients echo the CSRF token on unsafe requests
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+var (
+	// ErrInvalidCSRFToken is returned when the CSRF token is missing or does not match
+	ErrInvalidCSRFToken = errors.New("invalid csrf token")
+	// ErrOriginNotAllowed is returned when the Origin or Referer is not in the allowlist
+	ErrOriginNotAllowed = errors.New("origin not allowed")
+)
+
+// CSRFConfig configures the CSRF middleware
+type CSRFConfig struct {
+	// SecretKey signs the CSRF tokens
+	SecretKey []byte
+	// AllowedOrigins lists the origins allowed to send unsafe requests, e.g. https://app.feeti.com.
+	// When empty, only requests from the origin of the API itself are allowed
+	AllowedOrigins []string
+	// CookieName defaults to CSRFCookieName
+	CookieName string
+	// HeaderName defaults to CSRFHeaderName
+	HeaderName string
+	// SessionCookieName defaults to AuthCookieName. Requests without it are not cookie-authenticated and skip the check
+	SessionCookieName string
+}
+
+// GenerateCSRFToken returns a CSRF token bound to the user, so a token planted from
+// another account cannot be replayed against the user's session
+func GenerateCSRFToken(userID uuid.UUID, secretKey []byte) (string, error) {
+	if len(secretKey) == 0 || userID == uuid.Nil {
+		return "", fmt.Errorf("invalid user id")
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", fmt.Errorf("failed to generate csrf token: %w", err)
+	}
+	encodedNonce := base64.RawURLEncoding.EncodeToString(nonce[:])
+	return encodedNonce + "." + csrfSignature(userID, encodedNonce, secretKey), nil
+}
+
+// VerifyCSRFToken checks that the CSRF token was issued to the user
+func VerifyCSRFToken(token string, userID uuid.UUID, secretKey []byte) bool {
+	nonce, signature, ok := strings.Cut(token, ".")
+	if !ok || nonce == "" || len(secretKey) == 0 || userID == uuid.Nil {
+		return false
+	}
+	expected := csrfSignature(userID, nonce, secretKey)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func csrfSignature(userID uuid.UUID, nonce string, secretKey []byte) string {
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write([]byte("csrf|" + userID.String() + "|" + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueCSRFToken generates a CSRF token at login, sets it in the CSRF cookie next to
+// the ftk cookie and returns it in the X-CSRF-Token response header
+func IssueCSRFToken(c *gin.Context, userID uuid.UUID, secretKey []byte, domain string) (string, error) {
+	token, err := GenerateCSRFToken(userID, secretKey)
+	if err != nil {
+		return "", err
+	}
+	SetCSRFCookie(c, token, domain)
+	c.Header(CSRFHeaderName, token)
+	return token, nil
+}
+
+// SetCSRFCookie sets the CSRF token in a cookie readable by the frontend
+func SetCSRFCookie(c *gin.Context, token string, domain string) {
+	http.SetCookie(c.Writer, newCSRFCookie(c, token, domain, int(getTokenConfig().TTL.Seconds())))
+}
+
+// ClearCSRFCookie clears the CSRF cookie, e.g. on logout
+func ClearCSRFCookie(c *gin.Context, domain string) {
+	http.SetCookie(c.Writer, newCSRFCookie(c, "", domain, -1))
+}
+
+func newCSRFCookie(c *gin.Context, token string, domain string, maxAge int) *http.Cookie {
+	sameSite := http.SameSiteNoneMode
+	if domain == "localhost" {
+		sameSite = http.SameSiteLaxMode
+	}
+	return &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   domain,
+		MaxAge:   maxAge,
+		HttpOnly: false, // The frontend reads it to echo it in the header
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: sameSite,
+	}
+}
+
+// CSRFGin is a middleware protecting cookie-authenticated requests against cross-site
+// request forgery. Unsafe methods must come from an allowed origin and echo the CSRF
+// cookie in the X-CSRF-Token header. It must run after AuthGin, whose context key does not matter.
+func CSRFGin(cfg CSRFConfig) gin.HandlerFunc {
+	if cfg.CookieName == "" {
+		cfg.CookieName = CSRFCookieName
+	}
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = CSRFHeaderName
+	}
+	if cfg.SessionCookieName == "" {
+		cfg.SessionCookieName = AuthCookieName
+	}
+	allowed := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return func(c *gin.Context) {
+		// Safe methods must not change state
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			c.Next()
+			return
+		}
+
+		// Only requests authenticated by cookie can be forged cross-site
+		if _, err := c.Request.Cookie(cfg.SessionCookieName); err != nil {
+			c.Next()
+			return
+		}
+
+		// Check the origin of the request against the allowlist, or the API itself without one
+		origin := requestOrigin(c.Request)
+		if origin == "" || (len(allowed) > 0 && !allowed[origin]) || (len(allowed) == 0 && origin != ownOrigin(c.Request)) {
+			c.Abort()
+			helpers.HandleError(c, http.StatusForbidden, "Origin not allowed", ErrOriginNotAllowed)
+			return
+		}
+
+		// Double-submit: the header must match the cookie and be bound to the user
+		cookie, err := c.Request.Cookie(cfg.CookieName)
+		header := c.GetHeader(cfg.HeaderName)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 ||
+			!VerifyCSRFToken(header, UserIDFromContext(c.Request.Context()), cfg.SecretKey) {
+			c.Abort()
+			helpers.HandleError(c, http.StatusForbidden, "Invalid CSRF token", ErrInvalidCSRFToken)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requestOrigin returns the origin of the request from the Origin header, falling back to the Referer
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+		return strings.ToLower(strings.TrimSuffix(origin, "/"))
+	}
+	referer, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || referer.Scheme == "" || referer.Host == "" {
+		return ""
+	}
+	return strings.ToLower(referer.Scheme + "://" + referer.Host)
+}
+
+// ownOrigin returns the origin the request was sent to
+func ownOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return strings.ToLower(scheme + "://" + r.Host)
+}
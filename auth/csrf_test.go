@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSRFToken(t *testing.T) {
+	token, err := GenerateCSRFToken(userID, secretKey)
+	require.NoError(t, err)
+
+	assert.True(t, VerifyCSRFToken(token, userID, secretKey))
+	assert.False(t, VerifyCSRFToken(token, uuid.New(), secretKey), "token is bound to the user")
+	assert.False(t, VerifyCSRFToken(token, userID, []byte("other_secret")))
+	assert.False(t, VerifyCSRFToken("invalid", userID, secretKey))
+
+	_, err = GenerateCSRFToken(uuid.Nil, secretKey)
+	assert.Error(t, err)
+}
+
+func TestIssueCSRFToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+
+	token, err := IssueCSRFToken(c, userID, secretKey, "localhost")
+	require.NoError(t, err)
+	assert.Equal(t, token, w.Header().Get(CSRFHeaderName))
+
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, CSRFCookieName, cookies[0].Name)
+		assert.Equal(t, token, cookies[0].Value)
+		assert.False(t, cookies[0].HttpOnly, "the frontend must read the token")
+	}
+}
+
+func TestCSRFGin(t *testing.T) {
+	session, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	csrfToken, err := GenerateCSRFToken(userID, secretKey)
+	require.NoError(t, err)
+	otherToken, err := GenerateCSRFToken(uuid.New(), secretKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		method         string
+		session        bool
+		origin         string
+		referer        string
+		cookie         string
+		header         string
+		expectedStatus int
+	}{
+		{name: "Safe method", method: http.MethodGet, session: true, expectedStatus: 200},
+		{name: "Valid token", method: http.MethodPost, session: true, origin: "https://app.feeti.com", cookie: csrfToken, header: csrfToken, expectedStatus: 200},
+		{name: "Referer fallback", method: http.MethodPost, session: true, referer: "https://app.feeti.com/wallet", cookie: csrfToken, header: csrfToken, expectedStatus: 200},
+		{name: "Missing header", method: http.MethodPost, session: true, origin: "https://app.feeti.com", cookie: csrfToken, expectedStatus: 403},
+		{name: "Header mismatch", method: http.MethodDelete, session: true, origin: "https://app.feeti.com", cookie: csrfToken, header: otherToken, expectedStatus: 403},
+		{name: "Token of another user", method: http.MethodPost, session: true, origin: "https://app.feeti.com", cookie: otherToken, header: otherToken, expectedStatus: 403},
+		{name: "Foreign origin", method: http.MethodPost, session: true, origin: "https://evil.example", cookie: csrfToken, header: csrfToken, expectedStatus: 403},
+		{name: "No origin", method: http.MethodPost, session: true, cookie: csrfToken, header: csrfToken, expectedStatus: 403},
+		{name: "Bearer authenticated", method: http.MethodPost, session: false, expectedStatus: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(
+				NewAuthGin(WithSecretKey(secretKey), WithTokenExtractors(FromCookie(AuthCookieName), FromBearer())),
+				CSRFGin(CSRFConfig{SecretKey: secretKey, AllowedOrigins: []string{"https://app.feeti.com"}}),
+			)
+			r.Handle(tt.method, "/wallet", func(c *gin.Context) {
+				c.Status(200)
+			})
+
+			req := httptest.NewRequest(tt.method, "/wallet", nil)
+			if tt.session {
+				req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: session})
+			} else {
+				req.Header.Set("Authorization", "Bearer "+session)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeaderName, tt.header)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestCSRFGinDefaultsToSameOrigin(t *testing.T) {
+	session, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	csrfToken, err := GenerateCSRFToken(userID, secretKey)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewAuthGin(WithSecretKey(secretKey), WithContextKey("uid")), CSRFGin(CSRFConfig{SecretKey: secretKey}))
+	r.POST("/wallet", func(c *gin.Context) {
+		c.Status(200)
+	})
+
+	post := func(origin string) int {
+		req := httptest.NewRequest(http.MethodPost, "https://api.feeti.com/wallet", nil)
+		req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: session})
+		req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: csrfToken})
+		req.Header.Set(CSRFHeaderName, csrfToken)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post("https://api.feeti.com"), "same origin with a custom context key")
+	assert.Equal(t, http.StatusForbidden, post("https://evil.example"), "cross-origin requests are refused without an allowlist")
+	assert.Equal(t, http.StatusForbidden, post(""))
+}
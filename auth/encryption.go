@@ -0,0 +1,364 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// JWE algorithms supported by TokenEncrypter
+const (
+	// EncryptionDirect encrypts the token directly with the shared key
+	EncryptionDirect = "dir"
+	// EncryptionA128KW wraps a random content key with a 128-bit key
+	EncryptionA128KW = "A128KW"
+	// EncryptionA256KW wraps a random content key with a 256-bit key
+	EncryptionA256KW = "A256KW"
+)
+
+var (
+	// ErrUnknownEncryptionKey is returned when a token is encrypted with a key that is not in the encrypter
+	ErrUnknownEncryptionKey = errors.New("unknown encryption key")
+	// ErrDecryptionFailed is returned when a token cannot be decrypted
+	ErrDecryptionFailed = errors.New("failed to decrypt token")
+)
+
+// EncryptionKey is a symmetric key encrypting tokens into JWE, directly with AES-GCM or by
+// wrapping a random content key with AES key wrap
+type EncryptionKey struct {
+	id  string
+	alg string
+	key []byte
+}
+
+// NewDirectEncryptionKey returns a key encrypting tokens with A128GCM or A256GCM depending
+// on its length, 16 or 32 bytes
+func NewDirectEncryptionKey(id string, key []byte) (*EncryptionKey, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, fmt.Errorf("direct encryption key must be 16 or 32 bytes")
+	}
+	return &EncryptionKey{id: id, alg: EncryptionDirect, key: key}, nil
+}
+
+// NewKeyWrapEncryptionKey returns a key wrapping a random A256GCM content key per token
+// with A128KW or A256KW depending on its length, 16 or 32 bytes
+func NewKeyWrapEncryptionKey(id string, key []byte) (*EncryptionKey, error) {
+	switch len(key) {
+	case 16:
+		return &EncryptionKey{id: id, alg: EncryptionA128KW, key: key}, nil
+	case 32:
+		return &EncryptionKey{id: id, alg: EncryptionA256KW, key: key}, nil
+	}
+	return nil, fmt.Errorf("key wrap encryption key must be 16 or 32 bytes")
+}
+
+// ID returns the key identifier stamped in the kid header of encrypted tokens
+func (k *EncryptionKey) ID() string {
+	return k.id
+}
+
+// Algorithm returns the JWE key management algorithm of the key
+func (k *EncryptionKey) Algorithm() string {
+	return k.alg
+}
+
+// jweHeader is the protected header of the encrypted tokens
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Kid string `json:"kid,omitempty"`
+	Cty string `json:"cty"`
+}
+
+// TokenEncrypter encrypts signed tokens into JWE compact tokens so their claims cannot be
+// read by the client. It holds the active key and the retired keys still accepted for decryption
+type TokenEncrypter struct {
+	mu     sync.RWMutex
+	active *EncryptionKey
+	keys   map[string]*EncryptionKey
+}
+
+// NewTokenEncrypter creates an encrypter encrypting with the active key. Tokens encrypted
+// with the retired keys are still decrypted until the keys are removed
+func NewTokenEncrypter(active *EncryptionKey, retired ...*EncryptionKey) (*TokenEncrypter, error) {
+	if active == nil {
+		return nil, fmt.Errorf("active key is required")
+	}
+	keys := make(map[string]*EncryptionKey, len(retired)+1)
+	for _, key := range append([]*EncryptionKey{active}, retired...) {
+		if key == nil {
+			continue
+		}
+		if _, exists := keys[key.ID()]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID())
+		}
+		keys[key.ID()] = key
+	}
+	return &TokenEncrypter{active: active, keys: keys}, nil
+}
+
+// Rotate makes key the active encryption key. The previous active key keeps decrypting tokens
+func (e *TokenEncrypter) Rotate(key *EncryptionKey) error {
+	if key == nil {
+		return fmt.Errorf("key is required")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, exists := e.keys[key.ID()]; exists {
+		return fmt.Errorf("duplicate key id %q", key.ID())
+	}
+	e.keys[key.ID()] = key
+	e.active = key
+	return nil
+}
+
+// Remove drops a retired key. Tokens encrypted with it are rejected from now on
+func (e *TokenEncrypter) Remove(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.active.ID() == id {
+		return fmt.Errorf("cannot remove the active key %q", id)
+	}
+	delete(e.keys, id)
+	return nil
+}
+
+// Encrypt encrypts the signed token with the active key
+func (e *TokenEncrypter) Encrypt(token string) (string, error) {
+	e.mu.RLock()
+	key := e.active
+	e.mu.RUnlock()
+
+	header := jweHeader{Alg: key.alg, Enc: "A256GCM", Kid: key.id, Cty: "JWT"}
+	var cek, encryptedKey []byte
+	if key.alg == EncryptionDirect {
+		cek = key.key
+		if len(cek) == 16 {
+			header.Enc = "A128GCM"
+		}
+	} else {
+		cek = make([]byte, 32)
+		if _, err := rand.Read(cek); err != nil {
+			return "", fmt.Errorf("failed to generate content key: %w", err)
+		}
+		var err error
+		if encryptedKey, err = aesKeyWrap(key.key, cek); err != nil {
+			return "", err
+		}
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal header: %w", err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("failed to generate iv: %w", err)
+	}
+	// The protected header is authenticated as additional data
+	sealed := gcm.Seal(nil, iv, []byte(token), []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// Decrypt returns the signed token carried by the encrypted token. The key is selected by kid
+func (e *TokenEncrypter) Decrypt(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return "", ErrDecryptionFailed
+	}
+	var segments [5][]byte
+	for i, part := range parts {
+		segment, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return "", ErrDecryptionFailed
+		}
+		segments[i] = segment
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(segments[0], &header); err != nil {
+		return "", ErrDecryptionFailed
+	}
+	e.mu.RLock()
+	key, ok := e.keys[header.Kid]
+	e.mu.RUnlock()
+	if !ok {
+		return "", ErrUnknownEncryptionKey
+	}
+	// The algorithm is bound to the key, never to the token header
+	if header.Alg != key.alg {
+		return "", ErrDecryptionFailed
+	}
+
+	cek := key.key
+	if key.alg != EncryptionDirect {
+		var err error
+		if cek, err = aesKeyUnwrap(key.key, segments[1]); err != nil {
+			return "", ErrDecryptionFailed
+		}
+	} else if len(segments[1]) != 0 {
+		return "", ErrDecryptionFailed
+	}
+	if header.Enc != fmt.Sprintf("A%dGCM", len(cek)*8) {
+		return "", ErrDecryptionFailed
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", ErrDecryptionFailed
+	}
+	if len(segments[2]) != gcm.NonceSize() || len(segments[4]) != gcm.Overhead() {
+		return "", ErrDecryptionFailed
+	}
+	plaintext, err := gcm.Open(nil, segments[2], append(segments[3], segments[4]...), []byte(parts[0]))
+	if err != nil {
+		return "", ErrDecryptionFailed
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyWrapIV is the default initial value of RFC 3394
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// aesKeyWrap wraps the content key with the key encryption key as defined by RFC 3394
+func aesKeyWrap(kek, cek []byte) ([]byte, error) {
+	if len(cek)%8 != 0 || len(cek) < 16 {
+		return nil, fmt.Errorf("invalid content key length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	n := len(cek) / 8
+	out := make([]byte, len(cek)+8)
+	copy(out, keyWrapIV)
+	copy(out[8:], cek)
+	b := make([]byte, 16)
+	for j := range 6 {
+		for i := 1; i <= n; i++ {
+			copy(b, out[:8])
+			copy(b[8:], out[i*8:])
+			block.Encrypt(b, b)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(out[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[i*8:], b[8:])
+		}
+	}
+	return out, nil
+}
+
+// aesKeyUnwrap unwraps a content key wrapped by aesKeyWrap and checks its integrity
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, fmt.Errorf("invalid wrapped key length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	n := len(wrapped)/8 - 1
+	out := make([]byte, len(wrapped))
+	copy(out, wrapped)
+	b := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(out[:8])^t)
+			copy(b[8:], out[i*8:i*8+8])
+			block.Decrypt(b, b)
+			copy(out[:8], b[:8])
+			copy(out[i*8:], b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(out[:8], keyWrapIV) != 1 {
+		return nil, fmt.Errorf("wrapped key integrity check failed")
+	}
+	return out[8:], nil
+}
+
+// TokenEncryption configures the encrypted-token mode
+type TokenEncryption struct {
+	// Encrypter encrypts the tokens signed by the keys and keyrings and decrypts them on verification
+	Encrypter *TokenEncrypter
+	// AllowPlaintext keeps accepting tokens that are signed but not encrypted, e.g. the
+	// cookies issued before encryption was enabled
+	AllowPlaintext bool
+}
+
+var (
+	tokenEncryption   TokenEncryption
+	tokenEncryptionMu sync.RWMutex
+)
+
+// UseTokenEncryption enables the encrypted-token mode of GenerateToken, VerifyToken, the
+// keys, keyrings and AuthGin. Services verifying the tokens must enable it before the
+// issuers do. A nil Encrypter disables the mode
+func UseTokenEncryption(cfg TokenEncryption) {
+	tokenEncryptionMu.Lock()
+	defer tokenEncryptionMu.Unlock()
+	tokenEncryption = cfg
+}
+
+func getTokenEncryption() TokenEncryption {
+	tokenEncryptionMu.RLock()
+	defer tokenEncryptionMu.RUnlock()
+	return tokenEncryption
+}
+
+// encryptToken encrypts the signed token when the encrypted-token mode is enabled
+func encryptToken(token string) (string, error) {
+	cfg := getTokenEncryption()
+	if cfg.Encrypter == nil {
+		return token, nil
+	}
+	return cfg.Encrypter.Encrypt(token)
+}
+
+// decryptToken returns the signed token carried by an encrypted token when the
+// encrypted-token mode is enabled
+func decryptToken(token string) (string, error) {
+	cfg := getTokenEncryption()
+	if cfg.Encrypter == nil {
+		return token, nil
+	}
+	// A JWS has three segments, a JWE five
+	if strings.Count(token, ".") != 4 {
+		if cfg.AllowPlaintext {
+			return token, nil
+		}
+		return "", ErrDecryptionFailed
+	}
+	return cfg.Encrypter.Decrypt(token)
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	encryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	wrappingKey   = []byte("fedcba9876543210")
+)
+
+func useTestTokenEncryption(t testing.TB, cfg TokenEncryption) {
+	UseTokenEncryption(cfg)
+	t.Cleanup(func() { UseTokenEncryption(TokenEncryption{}) })
+}
+
+func newTestEncrypter(t testing.TB, id string, key []byte) *TokenEncrypter {
+	t.Helper()
+	encryptionKey, err := NewDirectEncryptionKey(id, key)
+	require.NoError(t, err)
+	encrypter, err := NewTokenEncrypter(encryptionKey)
+	require.NoError(t, err)
+	return encrypter
+}
+
+func TestAESKeyWrap(t *testing.T) {
+	// Test vectors of RFC 3394 sections 4.1 and 4.6
+	tests := []struct {
+		kek, cek, wrapped string
+	}{
+		{
+			kek:     "000102030405060708090A0B0C0D0E0F",
+			cek:     "00112233445566778899AABBCCDDEEFF",
+			wrapped: "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5",
+		},
+		{
+			kek:     "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+			cek:     "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+			wrapped: "28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21",
+		},
+	}
+	for _, tt := range tests {
+		kek, _ := hex.DecodeString(tt.kek)
+		cek, _ := hex.DecodeString(tt.cek)
+		expected, _ := hex.DecodeString(tt.wrapped)
+
+		wrapped, err := aesKeyWrap(kek, cek)
+		require.NoError(t, err)
+		assert.Equal(t, expected, wrapped)
+
+		unwrapped, err := aesKeyUnwrap(kek, wrapped)
+		require.NoError(t, err)
+		assert.Equal(t, cek, unwrapped)
+
+		wrapped[0] ^= 1
+		_, err = aesKeyUnwrap(kek, wrapped)
+		assert.Error(t, err)
+	}
+}
+
+func TestTokenEncrypter(t *testing.T) {
+	directKey, err := NewDirectEncryptionKey("direct", encryptionKey)
+	require.NoError(t, err)
+	wrapKey, err := NewKeyWrapEncryptionKey("wrap", wrappingKey)
+	require.NoError(t, err)
+
+	for _, key := range []*EncryptionKey{directKey, wrapKey} {
+		t.Run(key.Algorithm(), func(t *testing.T) {
+			encrypter, err := NewTokenEncrypter(key)
+			require.NoError(t, err)
+
+			token, err := GenerateToken(userID, secretKey)
+			require.NoError(t, err)
+			encrypted, err := encrypter.Encrypt(token)
+			require.NoError(t, err)
+			assert.Len(t, strings.Split(encrypted, "."), 5)
+			assert.NotContains(t, encrypted, token[:20])
+
+			decrypted, err := encrypter.Decrypt(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, token, decrypted)
+
+			// Any change to the token is detected
+			parts := strings.Split(encrypted, ".")
+			ciphertext, _ := base64.RawURLEncoding.DecodeString(parts[3])
+			ciphertext[0] ^= 1
+			parts[3] = base64.RawURLEncoding.EncodeToString(ciphertext)
+			_, err = encrypter.Decrypt(strings.Join(parts, "."))
+			assert.ErrorIs(t, err, ErrDecryptionFailed)
+		})
+	}
+
+	_, err = NewDirectEncryptionKey("short", []byte("short"))
+	assert.Error(t, err)
+}
+
+func TestTokenEncrypterRotation(t *testing.T) {
+	encrypter := newTestEncrypter(t, "2025-01", encryptionKey)
+	old, err := encrypter.Encrypt("token")
+	require.NoError(t, err)
+
+	next, err := NewKeyWrapEncryptionKey("2025-02", wrappingKey)
+	require.NoError(t, err)
+	require.NoError(t, encrypter.Rotate(next))
+
+	current, err := encrypter.Encrypt("token")
+	require.NoError(t, err)
+	for _, token := range []string{old, current} {
+		decrypted, err := encrypter.Decrypt(token)
+		require.NoError(t, err)
+		assert.Equal(t, "token", decrypted)
+	}
+
+	assert.Error(t, encrypter.Remove("2025-02"), "the active key cannot be removed")
+	require.NoError(t, encrypter.Remove("2025-01"))
+	_, err = encrypter.Decrypt(old)
+	assert.ErrorIs(t, err, ErrUnknownEncryptionKey)
+}
+
+func TestEncryptedTokenMode(t *testing.T) {
+	plain, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	useTestTokenEncryption(t, TokenEncryption{Encrypter: newTestEncrypter(t, "k1", encryptionKey)})
+
+	token, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(token, "."), 5)
+
+	id, err := VerifyToken(token, secretKey)
+	require.NoError(t, err)
+	assert.Equal(t, userID, id)
+
+	claims, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthGin(secretKey))
+	r.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserIDFromGin(c).String())
+	})
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := serve(token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, userID.String(), w.Body.String())
+
+	// Tokens that are only signed are rejected
+	_, err = VerifyToken(plain, secretKey)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve(plain).Code)
+}
+
+func TestEncryptedTokenModeAllowPlaintext(t *testing.T) {
+	plain, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	useTestTokenEncryption(t, TokenEncryption{Encrypter: newTestEncrypter(t, "k1", encryptionKey), AllowPlaintext: true})
+	_, err = VerifyToken(plain, secretKey)
+	assert.NoError(t, err)
+}
+
+func BenchmarkVerifyEncryptedToken(b *testing.B) {
+	useTestTokenEncryption(b, TokenEncryption{Encrypter: newTestEncrypter(b, "k1", encryptionKey)})
+	token, err := GenerateToken(userID, secretKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, err := VerifyToken(token, secretKey)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
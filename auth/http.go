@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HTTPUnauthorizedHandler writes the response of a request rejected by the net/http middleware
+type HTTPUnauthorizedHandler func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// WithHTTPUnauthorizedHandler replaces the default error response of the net/http middleware
+func WithHTTPUnauthorizedHandler(handler HTTPUnauthorizedHandler) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.onHTTPUnauthorized = handler
+	}
+}
+
+// AuthHandler is a net/http middleware that checks if the user is authenticated.
+// The user ID is retrieved with UserIDFromContext
+func AuthHandler(secretKey []byte) func(http.Handler) http.Handler {
+	return NewAuthHandler(WithSecretKey(secretKey))
+}
+
+// NewAuthHandler is the net/http equivalent of NewAuthGin. It accepts the same options,
+// WithContextKey and WithUnauthorizedHandler only apply to Gin
+func NewAuthHandler(opts ...AuthOption) func(http.Handler) http.Handler {
+	cfg := newAuthConfig(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, status, err := cfg.authenticate(r)
+			if err != nil {
+				cfg.onHTTPUnauthorized(w, r, status, err)
+				return
+			}
+			if claims == nil {
+				// Anonymous request let through by WithOptional
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Renew tokens about to expire when sliding renewal is enabled
+			if cfg.renewal != nil {
+				cfg.renewToken(w, r, claims)
+			}
+
+			r = r.WithContext(ContextWithClaims(r.Context(), claims))
+			if !claims.IsImpersonated() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Record every request served under impersonation, even when a handler panics
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				if err := recover(); err != nil {
+					cfg.audit(r, claims, http.StatusInternalServerError)
+					panic(err)
+				}
+				cfg.audit(r, claims, sw.status)
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// defaultHTTPUnauthorizedHandler writes the status package envelope
+func defaultHTTPUnauthorizedHandler(w http.ResponseWriter, _ *http.Request, status int, err error) {
+	message := unauthorizedMessage(status, err)
+	logger.Error(message)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"message": message,
+		"success": false,
+	})
+}
+
+// statusWriter records the status of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
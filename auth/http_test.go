@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthHandler(t *testing.T) {
+	validToken, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	var got uuid.UUID
+	handler := AuthHandler(secretKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = UserIDFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(validToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, userID, got)
+
+	w = serve("")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"message":"Unauthorized","success":false}`, w.Body.String())
+
+	w = serve("invalid_token")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"message":"Authentication failed","success":false}`, w.Body.String())
+}
+
+func TestNewAuthHandlerOptions(t *testing.T) {
+	validToken, err := GenerateToken(userID, secretKey, WithRoles("admin"))
+	require.NoError(t, err)
+
+	var claims *CustomClaims
+	var found bool
+	handler := NewAuthHandler(
+		WithSecretKey(secretKey),
+		WithTokenExtractors(FromBearer()),
+		WithOptional(),
+		WithHTTPUnauthorizedHandler(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			http.Error(w, err.Error(), http.StatusTeapot)
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, found = ClaimsFromContext(r.Context())
+	}))
+
+	// Anonymous request
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, found)
+
+	// Bearer token
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+validToken)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.True(t, found)
+	assert.True(t, claims.HasRole("admin"))
+
+	// Invalid tokens are still rejected
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer invalid_token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestAuthGinSetsRequestContext(t *testing.T) {
+	validToken, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthGin(secretKey))
+	var got uuid.UUID
+	r.GET("/ctx", func(c *gin.Context) {
+		got = UserIDFromContext(c.Request.Context())
+	})
+	req := httptest.NewRequest(http.MethodGet, "/ctx", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: validToken})
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, userID, got)
+}
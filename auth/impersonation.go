@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	helpers "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// DefaultImpersonationTTL is the lifetime of impersonation tokens when none is given.
+// They cannot be renewed past it
+const DefaultImpersonationTTL = 15 * time.Minute
+
+// ErrImpersonationForbidden is returned when a request is not allowed under impersonation
+var ErrImpersonationForbidden = errors.New("forbidden under impersonation")
+
+// Actor is the admin acting as the user of an impersonation token, carried in the act
+// claim as defined by RFC 8693
+type Actor struct {
+	UserID uuid.UUID `json:"sub"`
+	// Reason is why the admin impersonates the user, e.g. a support ticket
+	Reason string `json:"reason,omitempty"`
+}
+
+// GenerateImpersonationToken returns a token letting the admin see the app as the user
+// sees it. The token carries the user ID like a normal token and the admin in the act
+// claim. The caller must check that the actor is allowed to impersonate.
+// ttl <= 0 uses DefaultImpersonationTTL
+func GenerateImpersonationToken(signer Signer, actorID, userID uuid.UUID, reason string, ttl time.Duration, opts ...ClaimsOption) (string, error) {
+	if signer == nil || actorID == uuid.Nil || userID == uuid.Nil {
+		return "", fmt.Errorf("invalid user id")
+	}
+	if actorID == userID {
+		return "", fmt.Errorf("a user cannot impersonate themselves")
+	}
+	if reason == "" {
+		return "", fmt.Errorf("an impersonation reason is required")
+	}
+	if ttl <= 0 {
+		ttl = DefaultImpersonationTTL
+	}
+
+	now := tokenNow()
+	claims := CustomClaims{
+		UserID:           userID,
+		RegisteredClaims: newRegisteredClaims(now),
+	}
+	for _, opt := range opts {
+		opt(&claims)
+	}
+	claims.Actor = &Actor{UserID: actorID, Reason: reason}
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	// Sliding renewal cannot extend the impersonation
+	claims.SessionExpiresAt = claims.ExpiresAt
+	claims.StepUpAt = nil
+	return signer.Sign(claims)
+}
+
+// IsImpersonated reports whether the token is used by an admin acting as the user
+func (c *CustomClaims) IsImpersonated() bool {
+	return c.Actor != nil && c.Actor.UserID != uuid.Nil
+}
+
+// ImpersonationPolicy reports whether an impersonation token may make the request
+type ImpersonationPolicy func(r *http.Request, claims *CustomClaims) bool
+
+// ReadOnlyImpersonation lets impersonation tokens make GET, HEAD and OPTIONS requests
+// only, so an admin cannot withdraw or change a PIN. It is the default policy
+func ReadOnlyImpersonation(r *http.Request, _ *CustomClaims) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// WithImpersonationPolicy replaces ReadOnlyImpersonation. DenyImpersonation and
+// RequireStepUp still reject impersonation tokens on the routes they guard
+func WithImpersonationPolicy(policy ImpersonationPolicy) AuthOption {
+	return func(cfg *authConfig) {
+		if policy != nil {
+			cfg.impersonationPolicy = policy
+		}
+	}
+}
+
+// ImpersonationEvent is the audit record of a request made under impersonation
+type ImpersonationEvent struct {
+	ActorID uuid.UUID
+	UserID  uuid.UUID
+	Reason  string
+	TokenID string
+	Method  string
+	Path    string
+	// Status is the status of the response, 403 when the policy rejected the request
+	Status int
+	Time   time.Time
+}
+
+// ImpersonationAuditor records the requests made under impersonation, e.g. in an audit table
+type ImpersonationAuditor func(ctx context.Context, event ImpersonationEvent)
+
+// WithImpersonationAuditor records impersonated requests with the auditor instead of the
+// JSON logger. The auditor runs synchronously after the request is served
+func WithImpersonationAuditor(auditor ImpersonationAuditor) AuthOption {
+	return func(cfg *authConfig) {
+		if auditor != nil {
+			cfg.auditImpersonation = auditor
+		}
+	}
+}
+
+// defaultImpersonationAuditor writes the event to the JSON logger
+func defaultImpersonationAuditor(ctx context.Context, event ImpersonationEvent) {
+	logger.LogAttrs(ctx, slog.LevelInfo, "impersonation",
+		slog.String("actorID", event.ActorID.String()),
+		slog.String("userID", event.UserID.String()),
+		slog.String("reason", event.Reason),
+		slog.String("tokenID", event.TokenID),
+		slog.String("method", event.Method),
+		slog.String("path", event.Path),
+		slog.Int("status", event.Status),
+		slog.Time("time", event.Time),
+	)
+}
+
+// authorizeImpersonation applies the impersonation policy to impersonated requests
+func (cfg *authConfig) authorizeImpersonation(r *http.Request, claims *CustomClaims) error {
+	if !claims.IsImpersonated() || cfg.impersonationPolicy(r, claims) {
+		return nil
+	}
+	return ErrImpersonationForbidden
+}
+
+// audit records an impersonated request once it is served
+func (cfg *authConfig) audit(r *http.Request, claims *CustomClaims, status int) {
+	if !claims.IsImpersonated() {
+		return
+	}
+	cfg.auditImpersonation(r.Context(), ImpersonationEvent{
+		ActorID: claims.Actor.UserID,
+		UserID:  claims.UserID,
+		Reason:  claims.Actor.Reason,
+		TokenID: claims.ID,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Status:  status,
+		Time:    tokenNow(),
+	})
+}
+
+// DenyImpersonation is a middleware rejecting impersonation tokens with 403 whatever the
+// impersonation policy, e.g. on withdraw and PIN change routes. It must run after AuthGin
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonated := GetActorIDFromGin(c); impersonated {
+			c.Abort()
+			helpers.HandleError(c, http.StatusForbidden, "Not allowed while impersonating", ErrImpersonationForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetActorIDFromGin returns the admin impersonating the authenticated user. ok is false
+// when the request is made by the user themselves
+func GetActorIDFromGin(c *gin.Context) (actorID uuid.UUID, ok bool) {
+	claims, exists := GetClaimsFromGin(c)
+	if !exists || !claims.IsImpersonated() {
+		return uuid.Nil, false
+	}
+	return claims.Actor.UserID, true
+}
+
+// ActorIDFromContext returns the admin impersonating the authenticated user, see GetActorIDFromGin
+func ActorIDFromContext(ctx context.Context) (actorID uuid.UUID, ok bool) {
+	claims, exists := ClaimsFromContext(ctx)
+	if !exists || !claims.IsImpersonated() {
+		return uuid.Nil, false
+	}
+	return claims.Actor.UserID, true
+}
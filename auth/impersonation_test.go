@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAuditor collects the impersonation events
+type testAuditor struct {
+	mu     sync.Mutex
+	events []ImpersonationEvent
+}
+
+func (a *testAuditor) audit(_ context.Context, event ImpersonationEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, event)
+}
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	actorID := uuid.New()
+	token, err := GenerateImpersonationToken(newHMACKey(secretKey), actorID, userID, "ticket #42", 0)
+	require.NoError(t, err)
+
+	claims, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+	assert.True(t, claims.IsImpersonated())
+	assert.Equal(t, actorID, claims.Actor.UserID)
+	assert.Equal(t, "ticket #42", claims.Actor.Reason)
+	assert.Equal(t, claims.ExpiresAt, claims.SessionExpiresAt, "the impersonation cannot be renewed")
+	assert.WithinDuration(t, time.Now().Add(DefaultImpersonationTTL), claims.ExpiresAt.Time, 2*time.Second)
+
+	_, err = GenerateImpersonationToken(newHMACKey(secretKey), userID, userID, "ticket #42", 0)
+	assert.Error(t, err)
+	_, err = GenerateImpersonationToken(newHMACKey(secretKey), actorID, userID, "", 0)
+	assert.Error(t, err)
+
+	// Admins cannot step up on behalf of the user
+	_, err = StepUpToken(claims, newHMACKey(secretKey), AuthMethodOTP)
+	assert.ErrorIs(t, err, ErrImpersonationForbidden)
+	claims.StepUpAt = jwt.NewNumericDate(time.Now())
+	assert.False(t, claims.HasRecentStepUp(time.Minute))
+}
+
+func TestImpersonationGin(t *testing.T) {
+	actorID := uuid.New()
+	auditor := &testAuditor{}
+	token, err := GenerateImpersonationToken(newHMACKey(secretKey), actorID, userID, "ticket #42", 0)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewAuthGin(WithSecretKey(secretKey), WithImpersonationAuditor(auditor.audit)))
+	r.GET("/wallet", func(c *gin.Context) {
+		actor, impersonated := GetActorIDFromGin(c)
+		assert.True(t, impersonated)
+		assert.Equal(t, actorID, actor)
+		assert.Equal(t, userID, GetUserIDFromGin(c))
+		c.Status(http.StatusOK)
+	})
+	r.POST("/wallet/withdraw", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/pin", DenyImpersonation(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/wallet").Code)
+
+	w := serve(http.MethodPost, "/wallet/withdraw")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"message":"Not allowed while impersonating","success":false}`, w.Body.String())
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/pin").Code)
+
+	require.Len(t, auditor.events, 3)
+	assert.Equal(t, actorID, auditor.events[0].ActorID)
+	assert.Equal(t, userID, auditor.events[0].UserID)
+	assert.Equal(t, "ticket #42", auditor.events[0].Reason)
+	assert.Equal(t, "/wallet", auditor.events[0].Path)
+	assert.Equal(t, http.StatusOK, auditor.events[0].Status)
+	assert.Equal(t, http.StatusForbidden, auditor.events[1].Status)
+	assert.Equal(t, http.MethodPost, auditor.events[1].Method)
+	assert.Equal(t, http.StatusForbidden, auditor.events[2].Status)
+
+	// Normal tokens are not audited
+	normal, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/wallet/withdraw", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: normal})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, auditor.events, 3)
+}
+
+func TestImpersonationHandler(t *testing.T) {
+	actorID := uuid.New()
+	auditor := &testAuditor{}
+	token, err := GenerateImpersonationToken(newHMACKey(secretKey), actorID, userID, "ticket #42", 0)
+	require.NoError(t, err)
+
+	handler := NewAuthHandler(
+		WithSecretKey(secretKey),
+		WithImpersonationAuditor(auditor.audit),
+		WithImpersonationPolicy(func(r *http.Request, _ *CustomClaims) bool {
+			return r.URL.Path != "/wallet/withdraw"
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, impersonated := ActorIDFromContext(r.Context())
+		assert.True(t, impersonated)
+		assert.Equal(t, actorID, actor)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	serve := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusAccepted, serve("/profile"))
+	assert.Equal(t, http.StatusForbidden, serve("/wallet/withdraw"))
+
+	require.Len(t, auditor.events, 2)
+	assert.Equal(t, http.StatusAccepted, auditor.events[0].Status)
+	assert.Equal(t, http.StatusForbidden, auditor.events[1].Status)
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	var keys []*Key
+	for _, privateKey := range generateTestSigners(t) {
+		key, err := NewSigningKey(privateKey)
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/.well-known/jwks.json", JWKSHandler(keys...))
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"d"`, "private material must not be published")
+
+	var jwks JWKS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, len(keys))
+
+	byKid := make(map[string]JWK)
+	for _, jwk := range jwks.Keys {
+		assert.Equal(t, "sig", jwk.Use)
+		byKid[jwk.Kid] = jwk
+	}
+	for _, key := range keys {
+		jwk, ok := byKid[key.ID()]
+		if assert.True(t, ok, "key %s should be published", key.ID()) {
+			assert.Equal(t, key.Algorithm(), jwk.Alg)
+		}
+	}
+}
+
+func TestJWKSHandlerRejectsHMAC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/.well-known/jwks.json", JWKSHandler(newHMACKey(secretKey)))
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), string(secretKey))
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// RFC 7638 section 3.1 example key
+	jwk := JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	got, err := jwkThumbprint(jwk)
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", got)
+}
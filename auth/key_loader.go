@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyConfig describes where a key is loaded from
+type KeyConfig struct {
+	// ID is stamped in the kid header. Empty keeps the thumbprint of asymmetric keys
+	ID string
+	// File is a PEM private or public key, or a file holding an HMAC secret
+	File string
+	// Secret is an HMAC secret used when File is empty
+	Secret string
+}
+
+// KeyringConfig describes the keys of a keyring
+type KeyringConfig struct {
+	Active  KeyConfig
+	Retired []KeyConfig
+}
+
+// KeyringConfigFromEnv reads the keyring configuration from the environment.
+// The active key comes from JWT_KEY_ID and JWT_KEY_FILE or JWT_SECRET_KEY, the
+// retired keys from JWT_RETIRED_KEYS as a comma separated list of id=file entries.
+func KeyringConfigFromEnv() (KeyringConfig, error) {
+	cfg := KeyringConfig{
+		Active: KeyConfig{
+			ID:     os.Getenv("JWT_KEY_ID"),
+			File:   os.Getenv("JWT_KEY_FILE"),
+			Secret: os.Getenv("JWT_SECRET_KEY"),
+		},
+	}
+	if cfg.Active.File == "" && cfg.Active.Secret == "" {
+		return KeyringConfig{}, fmt.Errorf("JWT_KEY_FILE or JWT_SECRET_KEY not set")
+	}
+
+	retired := os.Getenv("JWT_RETIRED_KEYS")
+	if retired == "" {
+		return cfg, nil
+	}
+	for _, entry := range strings.Split(retired, ",") {
+		id, file, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || file == "" {
+			return KeyringConfig{}, fmt.Errorf("invalid JWT_RETIRED_KEYS entry %q", entry)
+		}
+		cfg.Retired = append(cfg.Retired, KeyConfig{ID: id, File: file})
+	}
+	return cfg, nil
+}
+
+// LoadKey loads the key described by the configuration
+func LoadKey(cfg KeyConfig) (*Key, error) {
+	var key *Key
+	var err error
+	if cfg.File != "" {
+		key, err = LoadKeyFile(cfg.File)
+	} else {
+		key, err = NewHMACKey([]byte(cfg.Secret))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ID != "" {
+		key = key.WithID(cfg.ID)
+	}
+	return key, nil
+}
+
+// LoadKeyFile loads a PEM private or public key. Files without PEM content hold an HMAC secret
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		return NewHMACKey(bytes.TrimSpace(data))
+	}
+	if bytes.Contains(data, []byte("PRIVATE KEY-----")) {
+		return ParsePrivateKeyPEM(data)
+	}
+	return ParsePublicKeyPEM(data)
+}
+
+// LoadKeyring loads every key of the configuration into a new keyring
+func LoadKeyring(cfg KeyringConfig) (*Keyring, error) {
+	active, retired, err := loadKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(active, retired...)
+}
+
+// Reload loads the keys of the configuration and swaps them in. The keyring is left
+// untouched if any key fails to load.
+func (k *Keyring) Reload(cfg KeyringConfig) error {
+	active, retired, err := loadKeys(cfg)
+	if err != nil {
+		return err
+	}
+	return k.Replace(active, retired...)
+}
+
+func loadKeys(cfg KeyringConfig) (*Key, []*Key, error) {
+	active, err := LoadKey(cfg.Active)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load active key: %w", err)
+	}
+
+	retired := make([]*Key, 0, len(cfg.Retired))
+	for _, keyCfg := range cfg.Retired {
+		key, err := LoadKey(keyCfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load retired key %q: %w", keyCfg.ID, err)
+		}
+		retired = append(retired, key)
+	}
+	return active, retired, nil
+}
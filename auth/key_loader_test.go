@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestKeyFiles(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	signers := generateTestSigners(t)
+
+	der, err := x509.MarshalPKCS8PrivateKey(signers["ES256"])
+	require.NoError(t, err)
+	privateFile := filepath.Join(dir, "active.pem")
+	require.NoError(t, os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	secretFile := filepath.Join(dir, "legacy.key")
+	require.NoError(t, os.WriteFile(secretFile, append(secretKey, '\n'), 0o600))
+
+	return privateFile, secretFile
+}
+
+func TestLoadKeyring(t *testing.T) {
+	privateFile, secretFile := writeTestKeyFiles(t)
+
+	keyring, err := LoadKeyring(KeyringConfig{
+		Active:  KeyConfig{ID: "2025-10", File: privateFile},
+		Retired: []KeyConfig{{ID: "2025-01", File: secretFile}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "2025-10", keyring.Active().ID())
+	assert.Equal(t, "ES256", keyring.Active().Algorithm())
+
+	retired, ok := keyring.Key("2025-01")
+	require.True(t, ok)
+	token, err := GenerateTokenWithSigner(userID, retired)
+	require.NoError(t, err)
+	_, err = VerifyTokenWithVerifier(token, keyring)
+	assert.NoError(t, err)
+}
+
+func TestKeyringReload(t *testing.T) {
+	privateFile, secretFile := writeTestKeyFiles(t)
+
+	keyring, err := LoadKeyring(KeyringConfig{Active: KeyConfig{ID: "old", File: secretFile}})
+	require.NoError(t, err)
+	oldToken, err := GenerateTokenWithSigner(userID, keyring)
+	require.NoError(t, err)
+
+	// Rotate: the new key signs, the old one is retired
+	require.NoError(t, keyring.Reload(KeyringConfig{
+		Active:  KeyConfig{ID: "new", File: privateFile},
+		Retired: []KeyConfig{{ID: "old", File: secretFile}},
+	}))
+	assert.Equal(t, "new", keyring.Active().ID())
+	_, err = VerifyTokenWithVerifier(oldToken, keyring)
+	assert.NoError(t, err)
+
+	// A failed reload keeps the current keys
+	err = keyring.Reload(KeyringConfig{Active: KeyConfig{File: filepath.Join(t.TempDir(), "missing.pem")}})
+	assert.Error(t, err)
+	assert.Equal(t, "new", keyring.Active().ID())
+}
+
+func TestKeyringConfigFromEnv(t *testing.T) {
+	privateFile, secretFile := writeTestKeyFiles(t)
+
+	t.Setenv("JWT_KEY_ID", "2025-10")
+	t.Setenv("JWT_KEY_FILE", privateFile)
+	t.Setenv("JWT_SECRET_KEY", "")
+	t.Setenv("JWT_RETIRED_KEYS", "2025-01="+secretFile)
+
+	cfg, err := KeyringConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, KeyConfig{ID: "2025-10", File: privateFile}, cfg.Active)
+	assert.Equal(t, []KeyConfig{{ID: "2025-01", File: secretFile}}, cfg.Retired)
+
+	t.Setenv("JWT_RETIRED_KEYS", "invalid")
+	_, err = KeyringConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("JWT_KEY_FILE", "")
+	_, err = KeyringConfigFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// ErrUnknownKey is returned when a token references a key that is not in the keyring
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// keyringParser accepts every supported algorithm, the key selected by kid decides which one is valid
+var keyringParser = jwt.NewParser(jwt.WithValidMethods(supportedAlgorithms()), jwt.WithoutClaimsValidation())
+
+// Keyring holds the active signing key and the retired keys still accepted for verification.
+// It implements Signer and Verifier and can be reloaded at runtime.
+type Keyring struct {
+	mu     sync.RWMutex
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeyring creates a keyring signing with the active key. Tokens signed by the
+// retired keys are still accepted until the keys are removed from the keyring.
+func NewKeyring(active *Key, retired ...*Key) (*Keyring, error) {
+	if active == nil {
+		return nil, fmt.Errorf("active key is required")
+	}
+	k := &Keyring{}
+	if err := k.Replace(active, retired...); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// NewVerificationKeyring creates a keyring that only verifies tokens, e.g. from a JWKS document
+func NewVerificationKeyring(keys ...*Key) (*Keyring, error) {
+	k := &Keyring{}
+	if err := k.Replace(nil, keys...); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Replace atomically swaps the keys of the keyring. A nil active key makes the keyring verify-only.
+func (k *Keyring) Replace(active *Key, retired ...*Key) error {
+	if active != nil && !active.CanSign() {
+		return ErrVerifyOnlyKey
+	}
+
+	keys := make(map[string]*Key, len(retired)+1)
+	for _, key := range append([]*Key{active}, retired...) {
+		if key == nil {
+			continue
+		}
+		if _, exists := keys[key.ID()]; exists {
+			return fmt.Errorf("duplicate key id %q", key.ID())
+		}
+		keys[key.ID()] = key
+	}
+
+	k.mu.Lock()
+	k.active = active
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Rotate makes key the active signing key. The previous active key is retired and keeps verifying tokens.
+func (k *Keyring) Rotate(key *Key) error {
+	if key == nil || !key.CanSign() {
+		return ErrVerifyOnlyKey
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, exists := k.keys[key.ID()]; exists {
+		return fmt.Errorf("duplicate key id %q", key.ID())
+	}
+	k.keys[key.ID()] = key
+	k.active = key
+	return nil
+}
+
+// Remove drops a retired key. Tokens signed with it are rejected from now on.
+func (k *Keyring) Remove(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.active != nil && k.active.ID() == id {
+		return fmt.Errorf("cannot remove the active key %q", id)
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+// Active returns the key currently used to sign tokens
+func (k *Keyring) Active() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Key returns the key registered under the given id
+func (k *Keyring) Key(id string) (*Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// PublicKeys returns the public part of every asymmetric key of the keyring
+func (k *Keyring) PublicKeys() []*Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := make([]*Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		if public := key.Public(); public != nil {
+			keys = append(keys, public)
+		}
+	}
+	return keys
+}
+
+// Sign signs the claims with the active key, stamping its id in the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	active := k.Active()
+	if active == nil {
+		return "", ErrVerifyOnlyKey
+	}
+	return active.Sign(claims)
+}
+
+// Verify selects the key by the kid header of the token and verifies it.
+// Tokens without kid are only accepted by a key registered without id.
+func (k *Keyring) Verify(tokenString string, claims jwt.Claims) error {
+	tokenString, err := decryptToken(tokenString)
+	if err != nil {
+		return fmt.Errorf("invalid token")
+	}
+	token, err := keyringParser.ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			key, ok := k.Key(kid)
+			if !ok {
+				return nil, ErrUnknownKey
+			}
+			// The algorithm is bound to the key, never to the token header
+			if token.Method.Alg() != key.Algorithm() {
+				return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+			}
+			return key.verifyKey, nil
+		},
+	)
+	if err != nil || !token.Valid || validateClaims(claims) != nil {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+// JWKSHandler publishes the current public keys of the keyring as a JWKS document
+func (k *Keyring) JWKSHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writeJWKS(c, k.PublicKeys())
+	}
+}
+
+// DefaultKeyringReloadInterval is how often ReloadEvery reloads the keyring when no interval is given
+const DefaultKeyringReloadInterval = 5 * time.Minute
+
+// ReloadEvery calls reload at every interval until ctx is done. Failed reloads are
+// logged and the keyring keeps its current keys. An interval of 0 or less, e.g. an
+// unset config value, defaults to DefaultKeyringReloadInterval.
+func (k *Keyring) ReloadEvery(ctx context.Context, interval time.Duration, reload func(*Keyring) error) {
+	if interval <= 0 {
+		interval = DefaultKeyringReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := reload(k); err != nil {
+					logger.Error(fmt.Sprintf("failed to reload keyring: %v", err))
+				}
+			}
+		}
+	}()
+}
+
+func supportedAlgorithms() []string {
+	algorithms := make([]string, 0, len(parsers))
+	for alg := range parsers {
+		algorithms = append(algorithms, alg)
+	}
+	return algorithms
+}
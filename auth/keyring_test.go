@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyringSignStampsKid(t *testing.T) {
+	key, err := NewSigningKey(generateTestSigners(t)["ES256"])
+	require.NoError(t, err)
+	keyring, err := NewKeyring(key)
+	require.NoError(t, err)
+
+	token, err := GenerateTokenWithSigner(userID, keyring)
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &UserClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, key.ID(), parsed.Header["kid"])
+
+	id, err := VerifyTokenWithVerifier(token, keyring)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, id)
+}
+
+func TestKeyringRotation(t *testing.T) {
+	signers := generateTestSigners(t)
+	oldKey, err := NewSigningKey(signers["RS256"])
+	require.NoError(t, err)
+	newKey, err := NewSigningKey(signers["EdDSA"])
+	require.NoError(t, err)
+
+	keyring, err := NewKeyring(oldKey)
+	require.NoError(t, err)
+	oldToken, err := GenerateTokenWithSigner(userID, keyring)
+	require.NoError(t, err)
+
+	// Tokens signed before the rotation are still accepted
+	require.NoError(t, keyring.Rotate(newKey))
+	assert.Equal(t, newKey, keyring.Active())
+	_, err = VerifyTokenWithVerifier(oldToken, keyring)
+	assert.NoError(t, err)
+
+	newToken, err := GenerateTokenWithSigner(userID, keyring)
+	require.NoError(t, err)
+	_, err = VerifyTokenWithVerifier(newToken, keyring)
+	assert.NoError(t, err)
+
+	// Removing the retired key rejects its tokens
+	require.NoError(t, keyring.Remove(oldKey.ID()))
+	_, err = VerifyTokenWithVerifier(oldToken, keyring)
+	assert.Error(t, err)
+	assert.Error(t, keyring.Remove(newKey.ID()), "active key cannot be removed")
+}
+
+func TestKeyringLegacyTokens(t *testing.T) {
+	current := newHMACKey([]byte("new_secret_key")).WithID("2025-10")
+	legacy := newHMACKey(secretKey)
+	keyring, err := NewKeyring(current, legacy)
+	require.NoError(t, err)
+
+	// Tokens minted before key ids existed have no kid header
+	legacyToken, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	_, err = VerifyTokenWithVerifier(legacyToken, keyring)
+	assert.NoError(t, err)
+
+	// An unknown kid is rejected
+	other := newHMACKey(secretKey).WithID("unknown")
+	otherToken, err := GenerateTokenWithSigner(userID, other)
+	require.NoError(t, err)
+	_, err = VerifyTokenWithVerifier(otherToken, keyring)
+	assert.Error(t, err)
+}
+
+func TestKeyringRejectsAlgorithmMismatch(t *testing.T) {
+	key, err := NewSigningKey(generateTestSigners(t)["ES256"])
+	require.NoError(t, err)
+	keyring, err := NewVerificationKeyring(key.Public())
+	require.NoError(t, err)
+
+	// HS256 token claiming the kid of the public key
+	forged, err := GenerateTokenWithSigner(userID, newHMACKey([]byte("attacker")).WithID(key.ID()))
+	require.NoError(t, err)
+	_, err = VerifyTokenWithVerifier(forged, keyring)
+	assert.Error(t, err)
+
+	_, err = GenerateTokenWithSigner(userID, keyring)
+	assert.ErrorIs(t, err, ErrVerifyOnlyKey)
+}
+
+func TestKeyringJWKSRoundTrip(t *testing.T) {
+	var keys []*Key
+	for _, privateKey := range generateTestSigners(t) {
+		key, err := NewSigningKey(privateKey)
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	keyring, err := NewKeyring(keys[0], keys[1:]...)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/.well-known/jwks.json", keyring.JWKSHandler())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// A verifying service rebuilds the keyring from the JWKS document
+	published, err := ParseJWKS(w.Body.Bytes())
+	require.NoError(t, err)
+	remote, err := NewVerificationKeyring(published...)
+	require.NoError(t, err)
+
+	for _, key := range keys {
+		token, err := GenerateTokenWithSigner(userID, key)
+		require.NoError(t, err)
+		_, err = VerifyTokenWithVerifier(token, remote)
+		assert.NoError(t, err, "token signed with %s", key.Algorithm())
+	}
+}
+
+func TestFetchJWKS(t *testing.T) {
+	key, err := NewSigningKey(generateTestSigners(t)["EdDSA"])
+	require.NoError(t, err)
+	jwks, err := NewJWKS(key)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	defer server.Close()
+
+	keys, err := FetchJWKS(context.Background(), server.URL)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.ID(), keys[0].ID())
+}
+
+func TestKeyringReloadEvery(t *testing.T) {
+	signers := generateTestSigners(t)
+	first, err := NewSigningKey(signers["ES256"])
+	require.NoError(t, err)
+	second, err := NewSigningKey(signers["EdDSA"])
+	require.NoError(t, err)
+	keyring, err := NewKeyring(first)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	keyring.ReloadEvery(ctx, 10*time.Millisecond, func(k *Keyring) error {
+		return k.Replace(second, first)
+	})
+
+	assert.Eventually(t, func() bool {
+		return keyring.Active() == second
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestKeyringReloadEveryWithoutInterval(t *testing.T) {
+	key, err := NewSigningKey(generateTestSigners(t)["ES256"])
+	require.NoError(t, err)
+	keyring, err := NewKeyring(key)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NotPanics(t, func() {
+		keyring.ReloadEvery(ctx, 0, func(*Keyring) error { return nil })
+	}, "an unset interval uses the default one")
+}
+
+func TestAuthGinWithKeyring(t *testing.T) {
+	key, err := NewSigningKey(generateTestSigners(t)["ES256"])
+	require.NoError(t, err)
+	keyring, err := NewKeyring(key)
+	require.NoError(t, err)
+	token, err := GenerateTokenWithSigner(userID, keyring)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthGinWithVerifier(keyring))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"userID": GetUserIDFromGin(c)})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: "ftk", Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), userID.String())
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	helpers "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DeviceIDHeader is the header in which the mobile apps send their device ID
+	DeviceIDHeader = "X-Device-ID"
+	// LockoutIdentifierKey is the Gin context key holding the user identifier of an attempt
+	LockoutIdentifierKey = "lockoutIdentifier"
+	// lockoutContextKey is the Gin context key holding the lockout of LockoutGin
+	lockoutContextKey = "lockout"
+)
+
+// ErrLockedOut is returned when too many attempts failed
+var ErrLockedOut = errors.New("too many failed attempts")
+
+// Attempt identifies where an authentication attempt comes from. Empty fields are not counted
+type Attempt struct {
+	IP string
+	// Identifier is the user the attempt is made for, e.g. a phone number
+	Identifier string
+	Device     string
+}
+
+// LockoutPolicy configures the lockout of one dimension of the attempts
+type LockoutPolicy struct {
+	// Threshold is the number of failures before the first lockout
+	Threshold int
+	// BaseWindow is the first lockout duration, it doubles with every failure after the threshold
+	BaseWindow time.Duration
+	// MaxWindow caps the lockout duration
+	MaxWindow time.Duration
+	// FailureWindow is how long failures are remembered
+	FailureWindow time.Duration
+}
+
+// LockoutConfig configures the lockout per IP, user identifier and device. IPs get a
+// higher threshold since many users can share one behind a NAT
+type LockoutConfig struct {
+	IP         LockoutPolicy
+	Identifier LockoutPolicy
+	Device     LockoutPolicy
+}
+
+// DefaultLockoutConfig returns the lockout thresholds used when a policy is left empty
+func DefaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		IP:         LockoutPolicy{Threshold: 20, BaseWindow: time.Minute, MaxWindow: time.Hour, FailureWindow: 24 * time.Hour},
+		Identifier: LockoutPolicy{Threshold: 5, BaseWindow: time.Minute, MaxWindow: time.Hour, FailureWindow: 24 * time.Hour},
+		Device:     LockoutPolicy{Threshold: 10, BaseWindow: time.Minute, MaxWindow: time.Hour, FailureWindow: 24 * time.Hour},
+	}
+}
+
+// Lockout throttles brute-force and credential-stuffing attacks. It is shared by the
+// login, OTP and PIN handlers
+type Lockout struct {
+	store LockoutStore
+	cfg   LockoutConfig
+	now   func() time.Time
+}
+
+// NewLockout creates a lockout component. The fields left empty in a policy fall back to
+// those of DefaultLockoutConfig
+func NewLockout(store LockoutStore, cfg LockoutConfig) *Lockout {
+	defaults := DefaultLockoutConfig()
+	cfg.IP = cfg.IP.withDefaults(defaults.IP)
+	cfg.Identifier = cfg.Identifier.withDefaults(defaults.Identifier)
+	cfg.Device = cfg.Device.withDefaults(defaults.Device)
+	return &Lockout{store: store, cfg: cfg, now: tokenNow}
+}
+
+// withDefaults replaces the empty or negative fields of the policy with those of defaults.
+// MaxWindow is raised to BaseWindow so the lockout always engages
+func (p LockoutPolicy) withDefaults(defaults LockoutPolicy) LockoutPolicy {
+	if p.Threshold <= 0 {
+		p.Threshold = defaults.Threshold
+	}
+	if p.BaseWindow <= 0 {
+		p.BaseWindow = defaults.BaseWindow
+	}
+	if p.MaxWindow <= 0 {
+		p.MaxWindow = defaults.MaxWindow
+	}
+	if p.FailureWindow <= 0 {
+		p.FailureWindow = defaults.FailureWindow
+	}
+	p.MaxWindow = max(p.MaxWindow, p.BaseWindow)
+	return p
+}
+
+type lockoutDimension struct {
+	key    string
+	policy LockoutPolicy
+}
+
+// dimensions returns the counters of the attempt
+func (l *Lockout) dimensions(attempt Attempt) []lockoutDimension {
+	var dims []lockoutDimension
+	if attempt.IP != "" {
+		dims = append(dims, lockoutDimension{key: "ip:" + attempt.IP, policy: l.cfg.IP})
+	}
+	if attempt.Identifier != "" {
+		dims = append(dims, lockoutDimension{key: "id:" + attempt.Identifier, policy: l.cfg.Identifier})
+	}
+	if attempt.Device != "" {
+		dims = append(dims, lockoutDimension{key: "device:" + attempt.Device, policy: l.cfg.Device})
+	}
+	return dims
+}
+
+// RegisterFailure counts a failed attempt. It returns how long the attempt is locked
+// out, zero when it is not
+func (l *Lockout) RegisterFailure(ctx context.Context, attempt Attempt) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, dim := range l.dimensions(attempt) {
+		failures, err := l.store.Increment(ctx, dim.key, dim.policy.FailureWindow)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count failure: %w", err)
+		}
+		if failures < dim.policy.Threshold {
+			continue
+		}
+		window := lockoutWindow(dim.policy, failures)
+		if err := l.store.Lock(ctx, dim.key, l.now().Add(window), window); err != nil {
+			return 0, fmt.Errorf("failed to lock out: %w", err)
+		}
+		retryAfter = max(retryAfter, window)
+	}
+	return retryAfter, nil
+}
+
+// RegisterSuccess clears the failures of the user identifier and device. The IP keeps
+// its failures so one valid account cannot hide a credential-stuffing attack
+func (l *Lockout) RegisterSuccess(ctx context.Context, attempt Attempt) error {
+	attempt.IP = ""
+	for _, dim := range l.dimensions(attempt) {
+		if err := l.store.Reset(ctx, dim.key); err != nil {
+			return fmt.Errorf("failed to reset failures: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsLocked reports whether any dimension of the attempt is locked out and for how long
+func (l *Lockout) IsLocked(ctx context.Context, attempt Attempt) (bool, time.Duration, error) {
+	var retryAfter time.Duration
+	now := l.now()
+	for _, dim := range l.dimensions(attempt) {
+		until, err := l.store.LockedUntil(ctx, dim.key)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to check lockout: %w", err)
+		}
+		if until.After(now) {
+			retryAfter = max(retryAfter, until.Sub(now))
+		}
+	}
+	return retryAfter > 0, retryAfter, nil
+}
+
+// lockoutWindow doubles the base window with every failure past the threshold
+func lockoutWindow(policy LockoutPolicy, failures int) time.Duration {
+	window := policy.BaseWindow
+	for i := policy.Threshold; i < failures && window < policy.MaxWindow; i++ {
+		window *= 2
+	}
+	return min(window, policy.MaxWindow)
+}
+
+// SetLockoutIdentifier records the user identifier of the attempt, e.g. the phone number
+// read from the login body, so LockoutGin counts its failures. Under LockoutGin it also
+// checks the lockout of the identifier: when locked out it aborts with 429 and reports
+// false, the handler must then return without verifying the credentials
+func SetLockoutIdentifier(c *gin.Context, identifier string) bool {
+	c.Set(LockoutIdentifierKey, identifier)
+	value, _ := c.Get(lockoutContextKey)
+	lockout, ok := value.(*Lockout)
+	if !ok {
+		return true
+	}
+	return checkLockout(c, lockout)
+}
+
+// AttemptFromGin returns the attempt of the request: client IP, X-Device-ID header and
+// the identifier set with SetLockoutIdentifier
+func AttemptFromGin(c *gin.Context) Attempt {
+	return Attempt{
+		IP:         c.ClientIP(),
+		Identifier: c.GetString(LockoutIdentifierKey),
+		Device:     c.GetHeader(DeviceIDHeader),
+	}
+}
+
+// LockoutGin is a middleware rejecting locked out clients with 429 and counting the
+// 401 and 403 responses of the next handlers as failures, 2xx as successes.
+// It only knows the IP and device of the request: handlers reading the user identifier
+// must call SetLockoutIdentifier before verifying the credentials, which enforces the
+// lockout of the account
+func LockoutGin(lockout *Lockout) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if !checkLockout(c, lockout) {
+			return
+		}
+		c.Set(lockoutContextKey, lockout)
+
+		c.Next()
+
+		switch status := c.Writer.Status(); {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			if _, err := lockout.RegisterFailure(ctx, AttemptFromGin(c)); err != nil {
+				logger.Error(fmt.Sprintf("failed to register failed attempt: %v", err))
+			}
+		case status >= 200 && status < 300:
+			if err := lockout.RegisterSuccess(ctx, AttemptFromGin(c)); err != nil {
+				logger.Error(fmt.Sprintf("failed to register successful attempt: %v", err))
+			}
+		}
+	}
+}
+
+// checkLockout aborts with 429 when the attempt of the request is locked out and reports
+// whether the request may go on
+func checkLockout(c *gin.Context, lockout *Lockout) bool {
+	locked, retryAfter, err := lockout.IsLocked(c.Request.Context(), AttemptFromGin(c))
+	if err != nil {
+		c.Abort()
+		helpers.HandleError(c, http.StatusInternalServerError, "Something went wrong", err)
+		return false
+	}
+	if locked {
+		c.Abort()
+		writeLockedOut(c, retryAfter)
+		return false
+	}
+	return true
+}
+
+// writeLockedOut aborts with 429 and the Retry-After header
+func writeLockedOut(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(retryAfter.Round(time.Second).Seconds())
+	c.Header("Retry-After", strconv.Itoa(max(seconds, 1)))
+	helpers.HandleError(c, http.StatusTooManyRequests, "Too many attempts", ErrLockedOut)
+}
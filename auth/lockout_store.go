@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+)
+
+// LockoutStore counts failed attempts and records lockouts
+type LockoutStore interface {
+	// Increment counts a failure and returns the number of failures. The count expires after ttl
+	Increment(ctx context.Context, key string, ttl time.Duration) (int, error)
+	// Lock locks the key out until the given time, the lock is kept for ttl
+	Lock(ctx context.Context, key string, until time.Time, ttl time.Duration) error
+	// LockedUntil returns the end of the lockout of the key, zero when it is not locked
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	// Reset clears the failures and lockout of the key
+	Reset(ctx context.Context, key string) error
+}
+
+// RedisLockoutStore stores failures and lockouts in Redis through the cache package
+type RedisLockoutStore struct{}
+
+// NewRedisLockoutStore returns a lockout store backed by Redis. cache.InitRedis must be called first
+func NewRedisLockoutStore() *RedisLockoutStore {
+	return &RedisLockoutStore{}
+}
+
+func lockoutFailuresKey(key string) string {
+	return fmt.Sprintf("lockout_failures:%s", key)
+}
+
+func lockoutKey(key string) string {
+	return fmt.Sprintf("lockout:%s", key)
+}
+
+// Increment counts a failure and returns the number of failures
+func (s *RedisLockoutStore) Increment(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	n, err := cache.IncrRedisData(ctx, lockoutFailuresKey(key), ttl)
+	return int(n), err
+}
+
+// Lock locks the key out until the given time
+func (s *RedisLockoutStore) Lock(ctx context.Context, key string, until time.Time, ttl time.Duration) error {
+	return cache.SetRedisDataTTL(ctx, lockoutKey(key), until.Unix(), ttl)
+}
+
+// LockedUntil returns the end of the lockout of the key, zero when it is not locked
+func (s *RedisLockoutStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	exists, err := cache.ExistsRedisData(ctx, lockoutKey(key))
+	if err != nil || !exists {
+		return time.Time{}, err
+	}
+	until, err := cache.GetRedisData[int64](ctx, lockoutKey(key))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(until, 0), nil
+}
+
+// Reset clears the failures and lockout of the key
+func (s *RedisLockoutStore) Reset(ctx context.Context, key string) error {
+	for _, k := range []string{lockoutFailuresKey(key), lockoutKey(key)} {
+		exists, err := cache.ExistsRedisData(ctx, k)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := cache.DeleteRedisData(ctx, k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MemoryLockoutStore keeps failures and lockouts in process memory. It is meant for tests
+type MemoryLockoutStore struct {
+	mu       sync.Mutex
+	failures map[string]memoryCounter
+	locks    map[string]time.Time
+}
+
+// NewMemoryLockoutStore returns an empty in-memory lockout store
+func NewMemoryLockoutStore() *MemoryLockoutStore {
+	return &MemoryLockoutStore{
+		failures: make(map[string]memoryCounter),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+// Increment counts a failure and returns the number of failures
+func (s *MemoryLockoutStore) Increment(_ context.Context, key string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.failures[key]
+	if counter.count == 0 || tokenNow().After(counter.expiresAt) {
+		counter = memoryCounter{expiresAt: tokenNow().Add(ttl)}
+	}
+	counter.count++
+	s.failures[key] = counter
+	return counter.count, nil
+}
+
+// Lock locks the key out until the given time
+func (s *MemoryLockoutStore) Lock(_ context.Context, key string, until time.Time, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[key] = until
+	return nil
+}
+
+// LockedUntil returns the end of the lockout of the key, zero when it is not locked
+func (s *MemoryLockoutStore) LockedUntil(_ context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locks[key], nil
+}
+
+// Reset clears the failures and lockout of the key
+func (s *MemoryLockoutStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, key)
+	delete(s.locks, key)
+	return nil
+}
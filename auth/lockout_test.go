@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLockout() *Lockout {
+	policy := LockoutPolicy{Threshold: 3, BaseWindow: time.Minute, MaxWindow: 4 * time.Minute, FailureWindow: time.Hour}
+	return NewLockout(NewMemoryLockoutStore(), LockoutConfig{IP: policy, Identifier: policy, Device: policy})
+}
+
+func TestLockoutExponentialWindows(t *testing.T) {
+	ctx := context.Background()
+	lockout := newTestLockout()
+	attempt := Attempt{Identifier: "+2250700000000"}
+
+	for range 2 {
+		retryAfter, err := lockout.RegisterFailure(ctx, attempt)
+		require.NoError(t, err)
+		assert.Zero(t, retryAfter)
+	}
+	locked, _, err := lockout.IsLocked(ctx, attempt)
+	require.NoError(t, err)
+	assert.False(t, locked)
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute}
+	for _, window := range expected {
+		retryAfter, err := lockout.RegisterFailure(ctx, attempt)
+		require.NoError(t, err)
+		assert.Equal(t, window, retryAfter)
+	}
+
+	locked, retryAfter, err := lockout.IsLocked(ctx, attempt)
+	require.NoError(t, err)
+	assert.True(t, locked)
+	assert.InDelta(t, float64(4*time.Minute), float64(retryAfter), float64(time.Second))
+
+	// The lockout ends with its window
+	lockout.now = func() time.Time { return time.Now().Add(5 * time.Minute) }
+	locked, _, err = lockout.IsLocked(ctx, attempt)
+	require.NoError(t, err)
+	assert.False(t, locked)
+}
+
+func TestLockoutPartialPolicy(t *testing.T) {
+	ctx := context.Background()
+	lockout := NewLockout(NewMemoryLockoutStore(), LockoutConfig{Identifier: LockoutPolicy{Threshold: 2}})
+	attempt := Attempt{Identifier: "+2250700000000"}
+
+	// The empty fields fall back to the defaults instead of disabling the lockout
+	defaults := DefaultLockoutConfig().Identifier
+	assert.Equal(t, LockoutPolicy{Threshold: 2, BaseWindow: defaults.BaseWindow, MaxWindow: defaults.MaxWindow, FailureWindow: defaults.FailureWindow}, lockout.cfg.Identifier)
+	assert.Equal(t, DefaultLockoutConfig().IP, lockout.cfg.IP)
+
+	_, err := lockout.RegisterFailure(ctx, attempt)
+	require.NoError(t, err)
+	retryAfter, err := lockout.RegisterFailure(ctx, attempt)
+	require.NoError(t, err)
+	assert.Equal(t, defaults.BaseWindow, retryAfter)
+	locked, _, err := lockout.IsLocked(ctx, attempt)
+	require.NoError(t, err)
+	assert.True(t, locked)
+}
+
+func TestLockoutPolicyWindows(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLockoutStore()
+	lockout := NewLockout(store, LockoutConfig{Identifier: LockoutPolicy{Threshold: 1, BaseWindow: time.Hour, MaxWindow: time.Minute}})
+	attempt := Attempt{Identifier: "+2250700000000"}
+
+	retryAfter, err := lockout.RegisterFailure(ctx, attempt)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, retryAfter, "MaxWindow cannot be below BaseWindow")
+
+	// The failures expire with the default failure window
+	counter := store.failures["id:"+attempt.Identifier]
+	assert.WithinDuration(t, time.Now().Add(DefaultLockoutConfig().Identifier.FailureWindow), counter.expiresAt, time.Minute)
+}
+
+func TestLockoutDimensions(t *testing.T) {
+	ctx := context.Background()
+	lockout := newTestLockout()
+
+	// Credential stuffing: many identifiers from one IP
+	for _, phone := range []string{"+1", "+2", "+3"} {
+		_, err := lockout.RegisterFailure(ctx, Attempt{IP: "10.0.0.1", Identifier: phone})
+		require.NoError(t, err)
+	}
+	locked, _, err := lockout.IsLocked(ctx, Attempt{IP: "10.0.0.1", Identifier: "+4"})
+	require.NoError(t, err)
+	assert.True(t, locked, "the IP is locked")
+
+	locked, _, err = lockout.IsLocked(ctx, Attempt{IP: "10.0.0.2", Identifier: "+1"})
+	require.NoError(t, err)
+	assert.False(t, locked, "each identifier has a single failure")
+
+	// A success does not clear the IP
+	require.NoError(t, lockout.RegisterSuccess(ctx, Attempt{IP: "10.0.0.1", Identifier: "+1"}))
+	locked, _, err = lockout.IsLocked(ctx, Attempt{IP: "10.0.0.1"})
+	require.NoError(t, err)
+	assert.True(t, locked)
+}
+
+func TestLockoutRegisterSuccess(t *testing.T) {
+	ctx := context.Background()
+	lockout := newTestLockout()
+	attempt := Attempt{Identifier: "+2250700000000", Device: "device-1"}
+
+	for range 2 {
+		_, err := lockout.RegisterFailure(ctx, attempt)
+		require.NoError(t, err)
+	}
+	require.NoError(t, lockout.RegisterSuccess(ctx, attempt))
+
+	retryAfter, err := lockout.RegisterFailure(ctx, attempt)
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter, "failures were cleared")
+}
+
+func TestLockoutGin(t *testing.T) {
+	lockout := newTestLockout()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LockoutGin(lockout), AuthGin(secretKey))
+	r.GET("/test", func(c *gin.Context) {
+		c.Status(200)
+	})
+
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(DeviceIDHeader, "device-1")
+		req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for range 3 {
+		assert.Equal(t, http.StatusUnauthorized, serve("invalid").Code)
+	}
+
+	token, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	w := serve(token)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "even a valid token is throttled")
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"message":"Too many attempts","success":false}`, w.Body.String())
+}
+
+func TestLockoutGinChecksIdentifier(t *testing.T) {
+	lockout := newTestLockout()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LockoutGin(lockout))
+	var verified int
+	r.POST("/login", func(c *gin.Context) {
+		if !SetLockoutIdentifier(c, c.Query("phone")) {
+			return
+		}
+		verified++
+		if c.Query("pin") != "1234" {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(ip, pin string) int {
+		req := httptest.NewRequest(http.MethodPost, "/login?phone=0700000000&pin="+pin, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The failures come from several IPs, only the account reaches the threshold
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		assert.Equal(t, http.StatusUnauthorized, serve(ip, "0000"), "attempt %d", i)
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.4", "1234"), "the account is locked from a new IP")
+	assert.Equal(t, 3, verified, "the credentials of a locked out account are not verified")
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidHash is returned when an encoded hash cannot be decoded
+	ErrInvalidHash = errors.New("invalid password hash")
+	// ErrIncompatibleVersion is returned when an Argon2 hash uses another version of the algorithm
+	ErrIncompatibleVersion = errors.New("incompatible argon2 version")
+)
+
+// Argon2Params are the Argon2id cost parameters. They are encoded in every hash so
+// they can be raised without breaking the existing hashes
+type Argon2Params struct {
+	// Memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follows the OWASP recommendation for Argon2id
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hasher hashes wallet PINs and passwords with Argon2id. It verifies legacy bcrypt hashes
+type Hasher struct {
+	params Argon2Params
+}
+
+// NewHasher creates a hasher with the given parameters
+func NewHasher(params Argon2Params) *Hasher {
+	return &Hasher{params: params}
+}
+
+var defaultHasher = NewHasher(DefaultArgon2Params)
+
+// HashPassword hashes a PIN or password with the default parameters
+func HashPassword(secret string) (string, error) {
+	return defaultHasher.Hash(secret)
+}
+
+// VerifyPassword checks a PIN or password against its hash with the default parameters
+func VerifyPassword(secret, encoded string) (ok bool, needsRehash bool, err error) {
+	return defaultHasher.Verify(secret, encoded)
+}
+
+// Hash returns the Argon2id hash of the secret in the PHC string format,
+// e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+func (h *Hasher) Hash(secret string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(secret), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify checks the secret against an Argon2id or bcrypt hash in constant time.
+// needsRehash is true when the secret matches a hash made with other parameters or
+// with bcrypt, the caller should then store a new hash made with Hash
+func (h *Hasher) Verify(secret, encoded string) (ok bool, needsRehash bool, err error) {
+	if isBcryptHash(encoded) {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(secret))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, ErrInvalidHash
+		}
+		return true, true, nil
+	}
+
+	params, salt, key, err := decodeArgon2Hash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	computed := argon2.IDKey([]byte(secret), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, computed) != 1 {
+		return false, false, nil
+	}
+	return true, h.NeedsRehash(encoded), nil
+}
+
+// NeedsRehash reports whether the hash was made with bcrypt or other parameters than the hasher's
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2Hash(encoded)
+	if err != nil {
+		return true
+	}
+	return params != h.params
+}
+
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func decodeArgon2Hash(encoded string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrIncompatibleVersion
+	}
+
+	var params Argon2Params
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	encoded, err := HashPassword("1234")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=19456,t=2,p=1$"))
+
+	other, err := HashPassword("1234")
+	require.NoError(t, err)
+	assert.NotEqual(t, encoded, other, "hashes are salted")
+
+	ok, needsRehash, err := VerifyPassword("1234", encoded)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	ok, _, err = VerifyPassword("4321", encoded)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = VerifyPassword("1234", "$argon2id$v=19$m=0,t=2,p=1$c2FsdA$aGFzaA")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+	_, _, err = VerifyPassword("1234", "$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$aGFzaA")
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+	_, _, err = VerifyPassword("1234", "plain")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+}
+
+func TestHasherNeedsRehash(t *testing.T) {
+	weak := NewHasher(Argon2Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	encoded, err := weak.Hash("backoffice-password")
+	require.NoError(t, err)
+
+	ok, needsRehash, err := VerifyPassword("backoffice-password", encoded)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash, "parameters were upgraded")
+	assert.False(t, weak.NeedsRehash(encoded))
+}
+
+func TestVerifyPasswordBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("backoffice-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	ok, needsRehash, err := VerifyPassword("backoffice-password", string(legacy))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash, "bcrypt hashes are migrated to Argon2id")
+
+	ok, needsRehash, err = VerifyPassword("wrong", string(legacy))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, needsRehash)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	helpers "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrForbidden is returned when the authenticated user lacks a role, scope or permission
+var ErrForbidden = errors.New("forbidden")
+
+// RequireRole is a middleware that only lets users holding every role through.
+// It must run after AuthGin. It panics without roles, which would let everyone through
+func RequireRole(roles ...string) gin.HandlerFunc {
+	mustNotBeEmpty("RequireRole", roles)
+	return requireClaims(func(claims *CustomClaims) bool {
+		return containsAll(claims.Roles, roles)
+	})
+}
+
+// RequireAnyRole is a middleware that only lets users holding at least one of the roles through.
+// It panics without roles
+func RequireAnyRole(roles ...string) gin.HandlerFunc {
+	mustNotBeEmpty("RequireAnyRole", roles)
+	return requireClaims(func(claims *CustomClaims) bool {
+		return containsAny(claims.Roles, roles)
+	})
+}
+
+// RequireScope is a middleware that only lets tokens holding every scope through.
+// It panics without scopes, which would let every token through
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	mustNotBeEmpty("RequireScope", scopes)
+	return requireClaims(func(claims *CustomClaims) bool {
+		return containsAll(claims.Scopes, scopes)
+	})
+}
+
+// RequireAnyScope is a middleware that only lets tokens holding at least one of the scopes through.
+// It panics without scopes
+func RequireAnyScope(scopes ...string) gin.HandlerFunc {
+	mustNotBeEmpty("RequireAnyScope", scopes)
+	return requireClaims(func(claims *CustomClaims) bool {
+		return containsAny(claims.Scopes, scopes)
+	})
+}
+
+// requireClaims aborts with 401 when no claims are attached and 403 when allowed returns false
+func requireClaims(allowed func(claims *CustomClaims) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetClaimsFromGin(c)
+		if !ok {
+			c.Abort()
+			helpers.HandleError(c, http.StatusUnauthorized, "Unauthorized", ErrMissingToken)
+			return
+		}
+		if !allowed(claims) {
+			c.Abort()
+			helpers.HandleError(c, http.StatusForbidden, "Forbidden", ErrForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// mustNotBeEmpty rejects a guard built without values, a mistake better caught at startup
+func mustNotBeEmpty(guard string, values []string) {
+	if len(values) == 0 {
+		panic(fmt.Sprintf("auth: %s called without values", guard))
+	}
+}
+
+func containsAll(values []string, wanted []string) bool {
+	for _, v := range wanted {
+		if !slices.Contains(values, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(values []string, wanted []string) bool {
+	for _, v := range wanted {
+		if slices.Contains(values, v) {
+			return true
+		}
+	}
+	return false
+}
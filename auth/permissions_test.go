@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveWithGuard(t *testing.T, token string, guard gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthGin(secretKey), guard)
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"message": "success"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetClaimsFromGin(t *testing.T) {
+	token, err := GenerateToken(userID, secretKey, WithRoles("admin"), WithScopes("wallet:withdraw"))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthGin(secretKey))
+	r.GET("/test", func(c *gin.Context) {
+		claims, ok := GetClaimsFromGin(c)
+		assert.True(t, ok)
+		assert.Equal(t, userID, claims.UserID)
+		assert.True(t, claims.HasRole("admin"))
+		assert.True(t, claims.HasScope("wallet:withdraw"))
+		assert.Equal(t, []string{"admin"}, GetRolesFromGin(c))
+		assert.Equal(t, []string{"wallet:withdraw"}, GetScopesFromGin(c))
+		c.Status(200)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRequireRole(t *testing.T) {
+	admin, err := GenerateToken(userID, secretKey, WithRoles("admin", "support"))
+	require.NoError(t, err)
+	support, err := GenerateToken(userID, secretKey, WithRoles("support"))
+	require.NoError(t, err)
+	customer, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		guard          gin.HandlerFunc
+		expectedStatus int
+	}{
+		{"Admin has role", admin, RequireRole("admin"), 200},
+		{"Admin has all roles", admin, RequireRole("admin", "support"), 200},
+		{"Support lacks role", support, RequireRole("admin"), 403},
+		{"Support has any role", support, RequireAnyRole("admin", "support"), 200},
+		{"Customer has no role", customer, RequireAnyRole("admin", "support"), 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWithGuard(t, tt.token, tt.guard)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == 403 {
+				assert.JSONEq(t, `{"message":"Forbidden","success":false}`, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	token, err := GenerateToken(userID, secretKey, WithScopes("wallet:withdraw", "wallet:get"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 200, serveWithGuard(t, token, RequireScope("wallet:withdraw", "wallet:get")).Code)
+	assert.Equal(t, 403, serveWithGuard(t, token, RequireScope("wallet:withdraw", "user:lock")).Code)
+	assert.Equal(t, 200, serveWithGuard(t, token, RequireAnyScope("user:lock", "wallet:withdraw")).Code)
+	assert.Equal(t, 403, serveWithGuard(t, token, RequireAnyScope("user:lock")).Code)
+}
+
+func TestRequireRoleWithoutAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequireRole("admin"))
+	r.GET("/test", func(c *gin.Context) {
+		c.Status(200)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRequireWithoutValuesPanics(t *testing.T) {
+	assert.Panics(t, func() { RequireRole() })
+	assert.Panics(t, func() { RequireAnyRole() })
+	assert.Panics(t, func() { RequireScope() })
+	assert.Panics(t, func() { RequireAnyScope() })
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxPINFailures is the number of wrong PINs locking the wallet when none is given
+	DefaultMaxPINFailures = 3
+	// DefaultPINFailureWindow is how long failures are counted when none is given
+	DefaultPINFailureWindow = 24 * time.Hour
+)
+
+var (
+	// ErrInvalidPIN is returned when the PIN does not match
+	ErrInvalidPIN = errors.New("invalid pin")
+	// ErrPINLocked is returned when the PIN is locked after too many failures
+	ErrPINLocked = errors.New("pin locked")
+)
+
+// PINAttemptStore counts the PIN attempts of each user since the last successful one
+type PINAttemptStore interface {
+	// Increment counts an attempt and returns the number of attempts. The count expires after ttl
+	Increment(ctx context.Context, userID uuid.UUID, ttl time.Duration) (int, error)
+	// Count returns the number of failures
+	Count(ctx context.Context, userID uuid.UUID) (int, error)
+	// Reset clears the failures
+	Reset(ctx context.Context, userID uuid.UUID) error
+}
+
+// PINVerifier checks wallet PINs and locks them after too many failures
+type PINVerifier struct {
+	store       PINAttemptStore
+	hasher      *Hasher
+	maxFailures int
+	window      time.Duration
+}
+
+// NewPINVerifier creates a PIN verifier locking the PIN after maxFailures wrong PINs within
+// window. The PIN stays locked until the window ends or Reset is called, e.g. after a PIN reset
+func NewPINVerifier(store PINAttemptStore, hasher *Hasher, maxFailures int, window time.Duration) *PINVerifier {
+	if hasher == nil {
+		hasher = defaultHasher
+	}
+	if maxFailures <= 0 {
+		maxFailures = DefaultMaxPINFailures
+	}
+	if window <= 0 {
+		window = DefaultPINFailureWindow
+	}
+	return &PINVerifier{store: store, hasher: hasher, maxFailures: maxFailures, window: window}
+}
+
+// Verify checks the PIN of the user against its hash. It returns ErrPINLocked when the PIN
+// is locked and ErrInvalidPIN on a wrong PIN. needsRehash asks the caller to store a new hash
+func (v *PINVerifier) Verify(ctx context.Context, userID uuid.UUID, pin, encoded string) (needsRehash bool, err error) {
+	// Count the attempt before comparing so concurrent guesses are counted too
+	attempts, err := v.store.Increment(ctx, userID, v.window)
+	if err != nil {
+		return false, fmt.Errorf("failed to count pin attempt: %w", err)
+	}
+	if attempts > v.maxFailures {
+		return false, ErrPINLocked
+	}
+
+	ok, needsRehash, err := v.hasher.Verify(pin, encoded)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		if attempts == v.maxFailures {
+			return false, ErrPINLocked
+		}
+		return false, ErrInvalidPIN
+	}
+
+	if err := v.store.Reset(ctx, userID); err != nil {
+		return false, fmt.Errorf("failed to reset pin failures: %w", err)
+	}
+	return needsRehash, nil
+}
+
+// IsLocked reports whether the PIN of the user is locked
+func (v *PINVerifier) IsLocked(ctx context.Context, userID uuid.UUID) (bool, error) {
+	failures, err := v.store.Count(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get pin failures: %w", err)
+	}
+	return failures >= v.maxFailures, nil
+}
+
+// Reset unlocks the PIN of the user
+func (v *PINVerifier) Reset(ctx context.Context, userID uuid.UUID) error {
+	return v.store.Reset(ctx, userID)
+}
+
+// RedisPINAttemptStore counts failed PIN attempts in Redis through the cache package
+type RedisPINAttemptStore struct{}
+
+// NewRedisPINAttemptStore returns a PIN attempt store backed by Redis. cache.InitRedis must be called first
+func NewRedisPINAttemptStore() *RedisPINAttemptStore {
+	return &RedisPINAttemptStore{}
+}
+
+func pinFailuresKey(userID uuid.UUID) string {
+	return fmt.Sprintf("pin_failures:%s", userID)
+}
+
+// Increment counts an attempt and returns the number of attempts
+func (s *RedisPINAttemptStore) Increment(ctx context.Context, userID uuid.UUID, ttl time.Duration) (int, error) {
+	n, err := cache.IncrRedisData(ctx, pinFailuresKey(userID), ttl)
+	return int(n), err
+}
+
+// Count returns the number of failures
+func (s *RedisPINAttemptStore) Count(ctx context.Context, userID uuid.UUID) (int, error) {
+	exists, err := cache.ExistsRedisData(ctx, pinFailuresKey(userID))
+	if err != nil || !exists {
+		return 0, err
+	}
+	return cache.GetRedisData[int](ctx, pinFailuresKey(userID))
+}
+
+// Reset clears the failures
+func (s *RedisPINAttemptStore) Reset(ctx context.Context, userID uuid.UUID) error {
+	exists, err := cache.ExistsRedisData(ctx, pinFailuresKey(userID))
+	if err != nil || !exists {
+		return err
+	}
+	return cache.DeleteRedisData(ctx, pinFailuresKey(userID))
+}
+
+// MemoryPINAttemptStore counts failed PIN attempts in process memory. It is meant for tests
+type MemoryPINAttemptStore struct {
+	mu       sync.Mutex
+	failures map[uuid.UUID]memoryCounter
+}
+
+type memoryCounter struct {
+	count     int
+	expiresAt time.Time
+}
+
+// NewMemoryPINAttemptStore returns an empty in-memory PIN attempt store
+func NewMemoryPINAttemptStore() *MemoryPINAttemptStore {
+	return &MemoryPINAttemptStore{failures: make(map[uuid.UUID]memoryCounter)}
+}
+
+// Increment counts an attempt and returns the number of attempts
+func (s *MemoryPINAttemptStore) Increment(_ context.Context, userID uuid.UUID, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.failures[userID]
+	if counter.count == 0 || tokenNow().After(counter.expiresAt) {
+		counter = memoryCounter{expiresAt: tokenNow().Add(ttl)}
+	}
+	counter.count++
+	s.failures[userID] = counter
+	return counter.count, nil
+}
+
+// Count returns the number of failures
+func (s *MemoryPINAttemptStore) Count(_ context.Context, userID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter, ok := s.failures[userID]
+	if !ok || tokenNow().After(counter.expiresAt) {
+		return 0, nil
+	}
+	return counter.count, nil
+}
+
+// Reset clears the failures
+func (s *MemoryPINAttemptStore) Reset(_ context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, userID)
+	return nil
+}
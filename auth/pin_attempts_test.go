@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPINVerifierLocksAfterFailures(t *testing.T) {
+	ctx := context.Background()
+	verifier := NewPINVerifier(NewMemoryPINAttemptStore(), nil, 3, time.Hour)
+	encoded, err := HashPassword("1234")
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(ctx, userID, "0000", encoded)
+	assert.ErrorIs(t, err, ErrInvalidPIN)
+	_, err = verifier.Verify(ctx, userID, "1111", encoded)
+	assert.ErrorIs(t, err, ErrInvalidPIN)
+	_, err = verifier.Verify(ctx, userID, "2222", encoded)
+	assert.ErrorIs(t, err, ErrPINLocked)
+
+	_, err = verifier.Verify(ctx, userID, "1234", encoded)
+	assert.ErrorIs(t, err, ErrPINLocked, "the right PIN is refused once locked")
+
+	// Other wallets are not affected
+	_, err = verifier.Verify(ctx, uuid.New(), "1234", encoded)
+	assert.NoError(t, err)
+
+	require.NoError(t, verifier.Reset(ctx, userID))
+	_, err = verifier.Verify(ctx, userID, "1234", encoded)
+	assert.NoError(t, err)
+}
+
+func TestPINVerifierResetsOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryPINAttemptStore()
+	verifier := NewPINVerifier(store, nil, 3, time.Hour)
+	encoded, err := HashPassword("1234")
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(ctx, userID, "0000", encoded)
+	assert.ErrorIs(t, err, ErrInvalidPIN)
+	_, err = verifier.Verify(ctx, userID, "1234", encoded)
+	require.NoError(t, err)
+
+	failures, err := store.Count(ctx, userID)
+	require.NoError(t, err)
+	assert.Zero(t, failures)
+}
+
+func TestPINVerifierConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	hasher := NewHasher(Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	verifier := NewPINVerifier(NewMemoryPINAttemptStore(), hasher, 3, time.Hour)
+	encoded, err := hasher.Hash("1234")
+	require.NoError(t, err)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		guesses int
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := verifier.Verify(ctx, userID, "0000", encoded)
+			if errors.Is(err, ErrInvalidPIN) {
+				mu.Lock()
+				guesses++
+				mu.Unlock()
+			} else {
+				assert.ErrorIs(t, err, ErrPINLocked)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, guesses, "concurrent requests cannot get more guesses than allowed")
+
+	_, err = verifier.Verify(ctx, userID, "1234", encoded)
+	assert.ErrorIs(t, err, ErrPINLocked)
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy maps roles to the permissions they grant. A permission ending with "*"
+// grants every permission sharing its prefix, e.g. "wallet:*" grants "wallet:withdraw".
+// The mapping can be reloaded at runtime.
+type Policy struct {
+	mu    sync.RWMutex
+	roles map[string][]string
+}
+
+// NewPolicy creates a policy from a role to permissions mapping
+func NewPolicy(roles map[string][]string) *Policy {
+	p := &Policy{}
+	p.Replace(roles)
+	return p
+}
+
+// LoadPolicy reads a JSON policy such as {"admin": ["*"], "support": ["user:get", "wallet:get"]}
+func LoadPolicy(r io.Reader) (*Policy, error) {
+	roles, err := decodePolicy(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicy(roles), nil
+}
+
+// LoadPolicyFile reads a JSON policy from a file
+func LoadPolicyFile(path string) (*Policy, error) {
+	p := &Policy{}
+	if err := p.ReloadFile(path); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReloadFile replaces the mapping with the content of a JSON policy file.
+// The policy is left untouched if the file cannot be read.
+func (p *Policy) ReloadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open policy file: %w", err)
+	}
+	defer f.Close()
+
+	roles, err := decodePolicy(f)
+	if err != nil {
+		return err
+	}
+	p.Replace(roles)
+	return nil
+}
+
+// Replace atomically swaps the role to permissions mapping
+func (p *Policy) Replace(roles map[string][]string) {
+	copied := make(map[string][]string, len(roles))
+	for role, permissions := range roles {
+		copied[role] = append([]string(nil), permissions...)
+	}
+
+	p.mu.Lock()
+	p.roles = copied
+	p.mu.Unlock()
+}
+
+// Allows reports whether any of the roles grants the permission
+func (p *Policy) Allows(roles []string, permission string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, role := range roles {
+		for _, granted := range p.roles[role] {
+			if matchPermission(granted, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Permissions returns every permission granted to the roles
+func (p *Policy) Permissions(roles []string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var permissions []string
+	for _, role := range roles {
+		permissions = append(permissions, p.roles[role]...)
+	}
+	return permissions
+}
+
+// RequirePermission is a middleware that only lets users whose roles grant every permission through.
+// It must run after AuthGin. It panics without permissions, which would let everyone through
+func (p *Policy) RequirePermission(permissions ...string) gin.HandlerFunc {
+	mustNotBeEmpty("RequirePermission", permissions)
+	return requireClaims(func(claims *CustomClaims) bool {
+		for _, permission := range permissions {
+			if !p.Allows(claims.Roles, permission) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func decodePolicy(r io.Reader) (map[string][]string, error) {
+	var roles map[string][]string
+	if err := json.NewDecoder(r).Decode(&roles); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %w", err)
+	}
+	return roles, nil
+}
+
+func matchPermission(granted, permission string) bool {
+	if prefix, ok := strings.CutSuffix(granted, "*"); ok {
+		return strings.HasPrefix(permission, prefix)
+	}
+	return granted == permission
+}
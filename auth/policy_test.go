@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	policy, err := LoadPolicy(strings.NewReader(`{
+		"admin": ["*"],
+		"support": ["user:get", "wallet:get"],
+		"finance": ["wallet:*"]
+	}`))
+	require.NoError(t, err)
+
+	assert.True(t, policy.Allows([]string{"admin"}, "user:lock"))
+	assert.True(t, policy.Allows([]string{"support"}, "user:get"))
+	assert.False(t, policy.Allows([]string{"support"}, "user:lock"))
+	assert.True(t, policy.Allows([]string{"finance"}, "wallet:withdraw"))
+	assert.False(t, policy.Allows([]string{"finance"}, "user:get"))
+	assert.True(t, policy.Allows([]string{"support", "finance"}, "wallet:withdraw"))
+	assert.False(t, policy.Allows(nil, "user:get"))
+	assert.ElementsMatch(t, []string{"user:get", "wallet:get"}, policy.Permissions([]string{"support"}))
+}
+
+func TestPolicyReloadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"support": ["user:get"]}`), 0o600))
+
+	policy, err := LoadPolicyFile(path)
+	require.NoError(t, err)
+	assert.False(t, policy.Allows([]string{"support"}, "user:lock"))
+
+	// Permissions change without redeploying
+	require.NoError(t, os.WriteFile(path, []byte(`{"support": ["user:get", "user:lock"]}`), 0o600))
+	require.NoError(t, policy.ReloadFile(path))
+	assert.True(t, policy.Allows([]string{"support"}, "user:lock"))
+
+	// An invalid file keeps the current mapping
+	require.NoError(t, os.WriteFile(path, []byte(`not json`), 0o600))
+	assert.Error(t, policy.ReloadFile(path))
+	assert.True(t, policy.Allows([]string{"support"}, "user:lock"))
+}
+
+func TestPolicyRequirePermission(t *testing.T) {
+	policy := NewPolicy(map[string][]string{"support": {"user:get"}})
+	support, err := GenerateToken(userID, secretKey, WithRoles("support"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 200, serveWithGuard(t, support, policy.RequirePermission("user:get")).Code)
+	assert.Equal(t, 403, serveWithGuard(t, support, policy.RequirePermission("user:get", "user:lock")).Code)
+}
+
+func TestPolicyRequirePermissionWithoutValuesPanics(t *testing.T) {
+	policy := NewPolicy(map[string][]string{"support": {"user:get"}})
+	assert.Panics(t, func() { policy.RequirePermission() })
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// TokenPurpose is the single action a purpose token allows
+type TokenPurpose string
+
+const (
+	// PurposeEmailVerification confirms the email address of the user
+	PurposeEmailVerification TokenPurpose = "email_verification"
+	// PurposePasswordReset allows to set a new password or PIN
+	PurposePasswordReset TokenPurpose = "password_reset"
+	// PurposeMagicLink logs the user in without password
+	PurposeMagicLink TokenPurpose = "magic_link"
+)
+
+// DefaultPurposeTokenTTL is the lifetime of purpose tokens whose purpose has no default
+const DefaultPurposeTokenTTL = 15 * time.Minute
+
+// purposeTokenTTLs are the default lifetimes of the purpose tokens
+var purposeTokenTTLs = map[TokenPurpose]time.Duration{
+	PurposeEmailVerification: 24 * time.Hour,
+	PurposePasswordReset:     15 * time.Minute,
+	PurposeMagicLink:         10 * time.Minute,
+}
+
+var (
+	// ErrTokenUsed is returned when a single-use token is presented again
+	ErrTokenUsed = errors.New("token already used")
+	// ErrCredentialChanged is returned when the credential bound to the token has changed
+	ErrCredentialChanged = errors.New("credential changed")
+)
+
+// PurposeClaims are the claims of a purpose token. They are distinct from CustomClaims
+// so they are never mistaken for a session
+type PurposeClaims struct {
+	UserID  uuid.UUID    `json:"userID"`
+	Purpose TokenPurpose `json:"purpose"`
+	// CredentialHash binds the token to the credential it was issued for, e.g. the password hash
+	CredentialHash string `json:"cred,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ConsumedTokenStore records the IDs of the single-use tokens already used
+type ConsumedTokenStore interface {
+	// Consume marks the token ID as used until expiresAt. It returns false when it was already used
+	Consume(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+}
+
+// PurposeTokenManager issues and checks single-use tokens for email verification,
+// password reset and magic links. Each purpose is signed with its own key derived from
+// the secret key, so these tokens are rejected by AuthGin and VerifyToken, and a token
+// of one purpose cannot be used for another
+type PurposeTokenManager struct {
+	secretKey []byte
+	store     ConsumedTokenStore
+}
+
+// NewPurposeTokenManager creates a purpose token manager. The secret key may be the one
+// of the session tokens since the signing keys are derived from it
+func NewPurposeTokenManager(secretKey []byte, store ConsumedTokenStore) (*PurposeTokenManager, error) {
+	if len(secretKey) == 0 {
+		return nil, fmt.Errorf("invalid secret key")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("invalid consumed token store")
+	}
+	return &PurposeTokenManager{secretKey: secretKey, store: store}, nil
+}
+
+// Generate returns a token allowing the purpose to the user. The token dies once the
+// credential changes, e.g. pass the current password hash for a reset link or the email
+// address for a verification link. An empty credential does not bind the token.
+// ttl <= 0 uses the default lifetime of the purpose
+func (m *PurposeTokenManager) Generate(userID uuid.UUID, purpose TokenPurpose, credential string, ttl time.Duration) (string, error) {
+	if userID == uuid.Nil {
+		return "", fmt.Errorf("invalid user id")
+	}
+	if purpose == "" {
+		return "", fmt.Errorf("invalid token purpose")
+	}
+	if ttl <= 0 {
+		ttl = defaultPurposeTokenTTL(purpose)
+	}
+
+	now := tokenNow()
+	claims := PurposeClaims{
+		UserID:           userID,
+		Purpose:          purpose,
+		RegisteredClaims: newRegisteredClaims(now),
+	}
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	if credential != "" {
+		claims.CredentialHash = m.credentialHash(purpose, credential)
+	}
+	return newHMACKey(m.purposeKey(purpose)).Sign(claims)
+}
+
+// Verify checks the token for the purpose and the current credential without using it,
+// e.g. to show the password reset form. Use Consume to perform the action
+func (m *PurposeTokenManager) Verify(tokenString string, purpose TokenPurpose, credential string) (*PurposeClaims, error) {
+	tokenString, err := decryptToken(tokenString)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := &PurposeClaims{}
+	token, err := jwtParser.ParseWithClaims(tokenString, claims, func(*jwt.Token) (any, error) {
+		return m.purposeKey(purpose), nil
+	})
+	if err != nil || !token.Valid || claims.Purpose != purpose || claims.UserID == uuid.Nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+	if err := validateClaims(claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// A token bound to a credential dies with it, an unbound token ignores the credential
+	if claims.CredentialHash != "" {
+		expected := m.credentialHash(purpose, credential)
+		if !hmac.Equal([]byte(claims.CredentialHash), []byte(expected)) {
+			return nil, ErrCredentialChanged
+		}
+	}
+	return claims, nil
+}
+
+// Consume verifies the token and marks it as used. It returns ErrTokenUsed when the token
+// has already been consumed
+func (m *PurposeTokenManager) Consume(ctx context.Context, tokenString string, purpose TokenPurpose, credential string) (*PurposeClaims, error) {
+	claims, err := m.Verify(tokenString, purpose, credential)
+	if err != nil {
+		return nil, err
+	}
+	// The token passes validation until its expiry plus the leeway, remember it that long
+	ok, err := m.store.Consume(ctx, claims.ID, acceptedUntil(claims.ExpiresAt.Time))
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume token: %w", err)
+	}
+	if !ok {
+		return nil, ErrTokenUsed
+	}
+	return claims, nil
+}
+
+// purposeKey derives the signing key of the purpose from the secret key
+func (m *PurposeTokenManager) purposeKey(purpose TokenPurpose) []byte {
+	mac := hmac.New(sha256.New, m.secretKey)
+	mac.Write([]byte("purpose_token:" + string(purpose)))
+	return mac.Sum(nil)
+}
+
+// credentialHash returns a keyed hash of the credential so the token does not reveal it
+func (m *PurposeTokenManager) credentialHash(purpose TokenPurpose, credential string) string {
+	mac := hmac.New(sha256.New, m.purposeKey(purpose))
+	mac.Write([]byte(credential))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func defaultPurposeTokenTTL(purpose TokenPurpose) time.Duration {
+	if ttl, ok := purposeTokenTTLs[purpose]; ok {
+		return ttl
+	}
+	return DefaultPurposeTokenTTL
+}
+
+// RedisConsumedTokenStore records consumed tokens in Redis through the cache package
+type RedisConsumedTokenStore struct{}
+
+// NewRedisConsumedTokenStore returns a consumed token store backed by Redis. cache.InitRedis must be called first
+func NewRedisConsumedTokenStore() *RedisConsumedTokenStore {
+	return &RedisConsumedTokenStore{}
+}
+
+func consumedTokenKey(tokenID string) string {
+	return fmt.Sprintf("consumed_token:%s", tokenID)
+}
+
+// Consume marks the token ID as used until expiresAt. It returns false when it was already used
+func (s *RedisConsumedTokenStore) Consume(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	ttl := expiresAt.Sub(tokenNow())
+	if ttl <= 0 {
+		// Expired tokens are rejected before being consumed, keep the ID a moment anyway
+		ttl = time.Second
+	}
+	// SET NX makes the first consumer win when the token is used concurrently
+	return cache.SetRedisDataNX(ctx, consumedTokenKey(tokenID), true, ttl)
+}
+
+// MemoryConsumedTokenStore records consumed tokens in process memory. It is meant for tests
+type MemoryConsumedTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}
+
+// NewMemoryConsumedTokenStore returns an empty in-memory consumed token store
+func NewMemoryConsumedTokenStore() *MemoryConsumedTokenStore {
+	return &MemoryConsumedTokenStore{tokens: make(map[string]time.Time)}
+}
+
+// Consume marks the token ID as used until expiresAt. It returns false when it was already used
+func (s *MemoryConsumedTokenStore) Consume(_ context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until, ok := s.tokens[tokenID]; ok && tokenNow().Before(until) {
+		return false, nil
+	}
+	s.tokens[tokenID] = expiresAt
+	return true, nil
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPurposeTokens(t *testing.T) *PurposeTokenManager {
+	t.Helper()
+	manager, err := NewPurposeTokenManager(secretKey, NewMemoryConsumedTokenStore())
+	require.NoError(t, err)
+	return manager
+}
+
+func TestPurposeTokenSingleUse(t *testing.T) {
+	ctx := context.Background()
+	manager := newTestPurposeTokens(t)
+	passwordHash, err := HashPassword("123456")
+	require.NoError(t, err)
+
+	token, err := manager.Generate(userID, PurposePasswordReset, passwordHash, 0)
+	require.NoError(t, err)
+
+	claims, err := manager.Verify(token, PurposePasswordReset, passwordHash)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), claims.ExpiresAt.Time, 2*time.Second)
+
+	// Verify does not use the token
+	claims, err = manager.Consume(ctx, token, PurposePasswordReset, passwordHash)
+	require.NoError(t, err)
+	assert.Equal(t, PurposePasswordReset, claims.Purpose)
+
+	_, err = manager.Consume(ctx, token, PurposePasswordReset, passwordHash)
+	assert.ErrorIs(t, err, ErrTokenUsed)
+}
+
+func TestPurposeTokenConcurrentConsume(t *testing.T) {
+	manager := newTestPurposeTokens(t)
+	token, err := manager.Generate(userID, PurposeMagicLink, "", 0)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var used atomic.Int32
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := manager.Consume(context.Background(), token, PurposeMagicLink, ""); err == nil {
+				used.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, used.Load())
+}
+
+func TestPurposeTokenCredentialBinding(t *testing.T) {
+	manager := newTestPurposeTokens(t)
+	oldHash, err := HashPassword("123456")
+	require.NoError(t, err)
+	newHash, err := HashPassword("654321")
+	require.NoError(t, err)
+
+	token, err := manager.Generate(userID, PurposePasswordReset, oldHash, 0)
+	require.NoError(t, err)
+
+	_, err = manager.Consume(context.Background(), token, PurposePasswordReset, newHash)
+	assert.ErrorIs(t, err, ErrCredentialChanged, "the link dies once the password changes")
+
+	// Unbound tokens ignore the credential
+	token, err = manager.Generate(userID, PurposeMagicLink, "", 0)
+	require.NoError(t, err)
+	_, err = manager.Verify(token, PurposeMagicLink, newHash)
+	assert.NoError(t, err)
+}
+
+func TestPurposeTokenRejected(t *testing.T) {
+	manager := newTestPurposeTokens(t)
+	token, err := manager.Generate(userID, PurposeEmailVerification, "user@feeti.co", 0)
+	require.NoError(t, err)
+
+	t.Run("Other purpose", func(t *testing.T) {
+		_, err := manager.Verify(token, PurposePasswordReset, "user@feeti.co")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expired, err := manager.Generate(userID, PurposeEmailVerification, "", time.Nanosecond)
+		require.NoError(t, err)
+		time.Sleep(time.Second)
+		_, err = manager.Verify(expired, PurposeEmailVerification, "")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Session token", func(t *testing.T) {
+		session, err := GenerateToken(userID, secretKey)
+		require.NoError(t, err)
+		_, err = manager.Verify(session, PurposeEmailVerification, "")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("VerifyToken", func(t *testing.T) {
+		_, err := VerifyToken(token, secretKey)
+		assert.Error(t, err)
+	})
+
+	t.Run("AuthGin", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(AuthGin(secretKey))
+		r.GET("/test", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestPurposeTokenDefaultTTL(t *testing.T) {
+	assert.Equal(t, 24*time.Hour, defaultPurposeTokenTTL(PurposeEmailVerification))
+	assert.Equal(t, 10*time.Minute, defaultPurposeTokenTTL(PurposeMagicLink))
+	assert.Equal(t, DefaultPurposeTokenTTL, defaultPurposeTokenTTL("phone_change"))
+}
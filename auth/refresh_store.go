@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRefreshTokenNotFound is returned when a refresh token is unknown or expired
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+)
+
+// RefreshRecord is the server-side state of a refresh token
+type RefreshRecord struct {
+	UserID    uuid.UUID `json:"userID"`
+	FamilyID  string    `json:"familyID"`
+	SessionID string    `json:"sessionID,omitempty"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RefreshStore persists hashed refresh tokens and their families
+type RefreshStore interface {
+	// Save stores the record under the token hash until ttl elapses
+	Save(ctx context.Context, hash string, record RefreshRecord, ttl time.Duration) error
+	// Get returns the record stored under the token hash
+	Get(ctx context.Context, hash string) (RefreshRecord, error)
+	// MarkUsed flags the token as rotated and reports whether it was already used
+	MarkUsed(ctx context.Context, hash string, ttl time.Duration) (bool, error)
+	// RevokeFamily revokes every refresh token of the family
+	RevokeFamily(ctx context.Context, familyID string, ttl time.Duration) error
+	// IsFamilyRevoked reports whether the family has been revoked
+	IsFamilyRevoked(ctx context.Context, familyID string) (bool, error)
+}
+
+// RedisRefreshStore stores refresh tokens in Redis through the cache package
+type RedisRefreshStore struct{}
+
+// NewRedisRefreshStore returns a refresh store backed by Redis. cache.InitRedis must be called first
+func NewRedisRefreshStore() *RedisRefreshStore {
+	return &RedisRefreshStore{}
+}
+
+func refreshTokenKey(hash string) string {
+	return fmt.Sprintf("refresh_token:%s", hash)
+}
+
+func refreshUsedKey(hash string) string {
+	return fmt.Sprintf("refresh_token_used:%s", hash)
+}
+
+func refreshFamilyKey(familyID string) string {
+	return fmt.Sprintf("refresh_family_revoked:%s", familyID)
+}
+
+// Save stores the record under the token hash until ttl elapses
+func (s *RedisRefreshStore) Save(ctx context.Context, hash string, record RefreshRecord, ttl time.Duration) error {
+	return cache.SetRedisDataTTL(ctx, refreshTokenKey(hash), record, ttl)
+}
+
+// Get returns the record stored under the token hash
+func (s *RedisRefreshStore) Get(ctx context.Context, hash string) (RefreshRecord, error) {
+	exists, err := cache.ExistsRedisData(ctx, refreshTokenKey(hash))
+	if err != nil {
+		return RefreshRecord{}, err
+	}
+	if !exists {
+		return RefreshRecord{}, ErrRefreshTokenNotFound
+	}
+	return cache.GetRedisData[RefreshRecord](ctx, refreshTokenKey(hash))
+}
+
+// MarkUsed flags the token as rotated and reports whether it was already used
+func (s *RedisRefreshStore) MarkUsed(ctx context.Context, hash string, ttl time.Duration) (bool, error) {
+	stored, err := cache.SetRedisDataNX(ctx, refreshUsedKey(hash), true, ttl)
+	if err != nil {
+		return false, err
+	}
+	return !stored, nil
+}
+
+// RevokeFamily revokes every refresh token of the family
+func (s *RedisRefreshStore) RevokeFamily(ctx context.Context, familyID string, ttl time.Duration) error {
+	return cache.SetRedisDataTTL(ctx, refreshFamilyKey(familyID), true, ttl)
+}
+
+// IsFamilyRevoked reports whether the family has been revoked
+func (s *RedisRefreshStore) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	return cache.ExistsRedisData(ctx, refreshFamilyKey(familyID))
+}
+
+// MemoryRefreshStore keeps refresh tokens in process memory. It is meant for tests
+type MemoryRefreshStore struct {
+	mu       sync.Mutex
+	records  map[string]memoryRefreshEntry
+	families map[string]time.Time
+}
+
+type memoryRefreshEntry struct {
+	record    RefreshRecord
+	used      bool
+	expiresAt time.Time
+}
+
+// NewMemoryRefreshStore returns an empty in-memory refresh store
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{
+		records:  make(map[string]memoryRefreshEntry),
+		families: make(map[string]time.Time),
+	}
+}
+
+// Save stores the record under the token hash until ttl elapses
+func (s *MemoryRefreshStore) Save(_ context.Context, hash string, record RefreshRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[hash] = memoryRefreshEntry{record: record, expiresAt: tokenNow().Add(ttl)}
+	return nil
+}
+
+// Get returns the record stored under the token hash
+func (s *MemoryRefreshStore) Get(_ context.Context, hash string) (RefreshRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.records[hash]
+	if !ok || tokenNow().After(entry.expiresAt) {
+		return RefreshRecord{}, ErrRefreshTokenNotFound
+	}
+	return entry.record, nil
+}
+
+// MarkUsed flags the token as rotated and reports whether it was already used
+func (s *MemoryRefreshStore) MarkUsed(_ context.Context, hash string, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.records[hash]
+	if !ok || tokenNow().After(entry.expiresAt) {
+		return false, ErrRefreshTokenNotFound
+	}
+	if entry.used {
+		return true, nil
+	}
+	entry.used = true
+	s.records[hash] = entry
+	return false, nil
+}
+
+// RevokeFamily revokes every refresh token of the family
+func (s *MemoryRefreshStore) RevokeFamily(_ context.Context, familyID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.families[familyID] = tokenNow().Add(ttl)
+	return nil
+}
+
+// IsFamilyRevoked reports whether the family has been revoked
+func (s *MemoryRefreshStore) IsFamilyRevoked(_ context.Context, familyID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, ok := s.families[familyID]
+	return ok && tokenNow().Before(expiresAt), nil
+}
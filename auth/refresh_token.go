@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRefreshTokenTTL is the lifetime of a refresh token when none is given
+const DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token cannot be used
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+	// The whole token family is revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// TokenPair holds an access token and the refresh token issued with it
+type TokenPair struct {
+	AccessToken      string    `json:"accessToken"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// RefreshManager issues and rotates refresh tokens
+type RefreshManager struct {
+	store  RefreshStore
+	signer Signer
+	ttl    time.Duration
+}
+
+// NewRefreshManager creates a refresh manager minting access tokens with the signer.
+// A zero ttl falls back to DefaultRefreshTokenTTL
+func NewRefreshManager(store RefreshStore, signer Signer, ttl time.Duration) *RefreshManager {
+	if ttl <= 0 {
+		ttl = DefaultRefreshTokenTTL
+	}
+	return &RefreshManager{store: store, signer: signer, ttl: ttl}
+}
+
+// TTL returns the lifetime of the refresh tokens issued by the manager
+func (m *RefreshManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// Issue generates a new access/refresh token pair starting a new token family
+func (m *RefreshManager) Issue(ctx context.Context, userID uuid.UUID) (*TokenPair, error) {
+	return m.issue(ctx, userID, uuid.NewString(), "")
+}
+
+// IssueForSession generates a new token pair bound to a registered session. The access
+// tokens minted from this pair, including after rotation, carry the session ID
+func (m *RefreshManager) IssueForSession(ctx context.Context, userID uuid.UUID, sessionID string) (*TokenPair, error) {
+	return m.issue(ctx, userID, uuid.NewString(), sessionID)
+}
+
+// Rotate exchanges a refresh token for a new token pair and invalidates the old refresh token.
+// Presenting a refresh token that was already rotated revokes its whole family.
+func (m *RefreshManager) Rotate(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	hash := hashRefreshToken(refreshToken)
+
+	// Find the record of the refresh token
+	record, err := m.store.Get(ctx, hash)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if tokenNow().After(record.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Reject tokens whose family has been revoked
+	revoked, err := m.store.IsFamilyRevoked(ctx, record.FamilyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check refresh token family: %w", err)
+	}
+	if revoked {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Reject tokens issued before the user's tokens were revoked
+	if store := getRevocationStore(); store != nil {
+		revoked, err := isIssuedBeforeCutoff(ctx, store, record.UserID, record.IssuedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrInvalidRefreshToken
+		}
+	}
+
+	// Mark the token as used, a second use means the token leaked
+	used, err := m.store.MarkUsed(ctx, hash, record.ExpiresAt.Sub(tokenNow()))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if used {
+		if err := m.store.RevokeFamily(ctx, record.FamilyID, m.ttl); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return m.issue(ctx, record.UserID, record.FamilyID, record.SessionID)
+}
+
+// Revoke revokes the family of the given refresh token, e.g. on logout
+func (m *RefreshManager) Revoke(ctx context.Context, refreshToken string) error {
+	record, err := m.store.Get(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+	return m.store.RevokeFamily(ctx, record.FamilyID, m.ttl)
+}
+
+func (m *RefreshManager) issue(ctx context.Context, userID uuid.UUID, familyID, sessionID string) (*TokenPair, error) {
+	accessToken, err := GenerateTokenWithSigner(userID, m.signer, WithSessionID(sessionID))
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the hash of the refresh token is stored
+	now := tokenNow()
+	expiresAt := now.Add(m.ttl)
+	record := RefreshRecord{UserID: userID, FamilyID: familyID, SessionID: sessionID, IssuedAt: now, ExpiresAt: expiresAt}
+	if err := m.store.Save(ctx, hashRefreshToken(refreshToken), record, m.ttl); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: expiresAt,
+	}, nil
+}
+
+// generateRefreshToken returns an opaque random refresh token
+func generateRefreshToken() (string, error) {
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
+
+// hashRefreshToken returns the hex encoded SHA-256 of the refresh token
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
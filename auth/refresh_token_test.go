@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshManagerIssue(t *testing.T) {
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), 0)
+
+	pair, err := manager.Issue(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.NotEmpty(t, pair.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(DefaultRefreshTokenTTL), pair.RefreshExpiresAt, time.Second)
+
+	id, err := VerifyToken(pair.AccessToken, secretKey)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, id)
+}
+
+func TestRefreshManagerRotate(t *testing.T) {
+	ctx := context.Background()
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), time.Hour)
+
+	pair, err := manager.Issue(ctx, userID)
+	assert.NoError(t, err)
+
+	rotated, err := manager.Rotate(ctx, pair.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+
+	id, err := VerifyToken(rotated.AccessToken, secretKey)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, id)
+
+	// The new refresh token can be rotated in turn
+	_, err = manager.Rotate(ctx, rotated.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRefreshManagerReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), time.Hour)
+
+	pair, err := manager.Issue(ctx, userID)
+	assert.NoError(t, err)
+
+	rotated, err := manager.Rotate(ctx, pair.RefreshToken)
+	assert.NoError(t, err)
+
+	// Replaying the old refresh token is detected
+	_, err = manager.Rotate(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	// The legitimate child token dies with its family
+	_, err = manager.Rotate(ctx, rotated.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshManagerRevoke(t *testing.T) {
+	ctx := context.Background()
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), time.Hour)
+
+	pair, err := manager.Issue(ctx, userID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, manager.Revoke(ctx, pair.RefreshToken))
+
+	_, err = manager.Rotate(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshManagerInvalidToken(t *testing.T) {
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), time.Hour)
+
+	_, err := manager.Rotate(context.Background(), "")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	_, err = manager.Rotate(context.Background(), "unknown_token")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestSetRefreshCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+
+	SetRefreshCookie(c, "refresh_token", "localhost", "/auth/refresh", time.Hour)
+
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, RefreshCookieName, cookies[0].Name)
+		assert.Equal(t, "refresh_token", cookies[0].Value)
+		assert.Equal(t, "/auth/refresh", cookies[0].Path)
+		assert.Equal(t, 3600, cookies[0].MaxAge)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+}
+
+func BenchmarkRefreshManagerRotate(b *testing.B) {
+	ctx := context.Background()
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), time.Hour)
+	pair, err := manager.Issue(ctx, userID)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		pair, err = manager.Rotate(ctx, pair.RefreshToken)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultRenewalWindow is how long before expiry a token is renewed when none is given
+	DefaultRenewalWindow = 5 * time.Minute
+	// DefaultMaxSessionLifetime is how long a token can be renewed when none is given
+	DefaultMaxSessionLifetime = 12 * time.Hour
+	// RenewedTokenHeader is the response header holding the renewed token when the
+	// request did not carry it in the auth cookie, e.g. a bearer token
+	RenewedTokenHeader = "X-Renewed-Token"
+)
+
+// RenewalConfig configures the sliding renewal of AuthGin
+type RenewalConfig struct {
+	// Signer signs the renewed tokens. It defaults to the verifier of the middleware
+	// when it can sign, e.g. WithSecretKey or a keyring
+	Signer Signer
+	// Window renews tokens expiring within it. It defaults to DefaultRenewalWindow
+	Window time.Duration
+	// MaxLifetime bounds the session of tokens without sexp claim, counted from their
+	// issue time. It defaults to DefaultMaxSessionLifetime
+	MaxLifetime time.Duration
+	// Domain is the domain of the rewritten cookie
+	Domain string
+}
+
+// WithSlidingRenewal reissues tokens close to expiry so active users are not logged out.
+// Tokens read from the auth cookie, see WithCookieName, are renewed in that cookie, the
+// others in the X-Renewed-Token response header. Renewed tokens never outlive the sexp
+// claim, set at login with WithSessionExpiry
+func WithSlidingRenewal(renewal RenewalConfig) AuthOption {
+	return func(cfg *authConfig) {
+		if renewal.Window <= 0 {
+			renewal.Window = DefaultRenewalWindow
+		}
+		if renewal.MaxLifetime <= 0 {
+			renewal.MaxLifetime = DefaultMaxSessionLifetime
+		}
+		cfg.renewal = &renewal
+	}
+}
+
+// renewToken sends a renewed token when the token is about to expire, in the cookie
+// it came from or in the X-Renewed-Token header
+func (cfg *authConfig) renewToken(w http.ResponseWriter, r *http.Request, claims *CustomClaims) {
+	renewal := cfg.renewal
+	if claims.ExpiresAt == nil || claims.ExpiresAt.Sub(tokenNow()) > renewal.Window {
+		return
+	}
+	signer := renewal.Signer
+	if signer == nil {
+		// The verifier of WithSecretKey and keyrings can sign
+		signer, _ = cfg.verifier.(Signer)
+	}
+	if signer == nil {
+		logger.Error("failed to renew token: no signer configured")
+		return
+	}
+
+	token, err := RenewToken(claims, signer, renewal.MaxLifetime)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to renew token: %v", err))
+		return
+	}
+	if token == "" {
+		return
+	}
+	if cookie, err := r.Cookie(cfg.cookieName); err == nil && cookie.Value == extractToken(r, cfg.extractors) {
+		renewed := newSecureCookie(r, token, renewal.Domain)
+		renewed.Name = cfg.cookieName
+		http.SetCookie(w, renewed)
+		return
+	}
+	w.Header().Set(RenewedTokenHeader, token)
+}
+
+// RenewToken reissues the token with a fresh expiry, keeping its other claims. The
+// new expiry is capped by the sexp claim, or by the issue time plus maxLifetime when
+// the token has none. An empty token is returned when the session cannot be extended
+func RenewToken(claims *CustomClaims, signer Signer, maxLifetime time.Duration) (string, error) {
+	if signer == nil || claims.UserID == uuid.Nil {
+		return "", fmt.Errorf("invalid user id")
+	}
+
+	now := tokenNow()
+	sessionExpiresAt := now.Add(maxLifetime)
+	switch {
+	case claims.SessionExpiresAt != nil:
+		sessionExpiresAt = claims.SessionExpiresAt.Time
+	case claims.IssuedAt != nil:
+		sessionExpiresAt = claims.IssuedAt.Add(maxLifetime)
+	}
+
+	expiresAt := now.Add(getTokenConfig().TTL)
+	if expiresAt.After(sessionExpiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+	// Nothing to gain once the session reached its maximum lifetime
+	if claims.ExpiresAt != nil && !expiresAt.After(claims.ExpiresAt.Time) {
+		return "", nil
+	}
+
+	renewed := *claims
+	renewed.ID = newTokenID(now)
+	renewed.IssuedAt = jwt.NewNumericDate(now)
+	renewed.NotBefore = jwt.NewNumericDate(now)
+	renewed.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	renewed.SessionExpiresAt = jwt.NewNumericDate(sessionExpiresAt)
+	return signer.Sign(renewed)
+}
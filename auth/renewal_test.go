@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signTestClaims(t *testing.T, issuedAt, expiresAt time.Time, opts ...ClaimsOption) string {
+	claims := CustomClaims{
+		UserID: userID,
+		Roles:  []string{"support"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	for _, opt := range opts {
+		opt(&claims)
+	}
+	token, err := newHMACKey(secretKey).Sign(claims)
+	require.NoError(t, err)
+	return token
+}
+
+func serveWithRenewal(t *testing.T, token string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewAuthGin(WithSecretKey(secretKey), WithSlidingRenewal(RenewalConfig{
+		Window:      5 * time.Minute,
+		MaxLifetime: time.Hour,
+		Domain:      "localhost",
+	})))
+	r.GET("/test", func(c *gin.Context) {
+		c.Status(200)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func renewedCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == AuthCookieName {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestAuthGinSlidingRenewal(t *testing.T) {
+	now := time.Now()
+
+	// A fresh token is left untouched
+	fresh := signTestClaims(t, now, now.Add(30*time.Minute))
+	w := serveWithRenewal(t, fresh)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, renewedCookie(w))
+
+	// A token about to expire is reissued with its claims
+	expiring := signTestClaims(t, now.Add(-27*time.Minute), now.Add(3*time.Minute), WithSessionID("session-id"))
+	w = serveWithRenewal(t, expiring)
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookie := renewedCookie(w)
+	require.NotNil(t, cookie)
+
+	claims, err := VerifyTokenClaims(cookie.Value, newHMACKey(secretKey))
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+	assert.Equal(t, []string{"support"}, claims.Roles)
+	assert.Equal(t, "session-id", claims.SessionID)
+	assert.True(t, claims.ExpiresAt.After(now.Add(25*time.Minute)))
+	require.NotNil(t, claims.SessionExpiresAt)
+	assert.WithinDuration(t, now.Add(33*time.Minute), claims.SessionExpiresAt.Time, time.Second, "bounded by iat + max lifetime")
+}
+
+func TestAuthGinSlidingRenewalMaxLifetime(t *testing.T) {
+	now := time.Now()
+
+	// The renewed token cannot outlive the session
+	nearEnd := signTestClaims(t, now.Add(-20*time.Minute), now.Add(2*time.Minute), WithSessionExpiry(now.Add(10*time.Minute)))
+	cookie := renewedCookie(serveWithRenewal(t, nearEnd))
+	require.NotNil(t, cookie)
+	claims, err := VerifyTokenClaims(cookie.Value, newHMACKey(secretKey))
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(10*time.Minute), claims.ExpiresAt.Time, time.Second)
+
+	// Once the session reached its maximum lifetime the token is not renewed
+	ended := signTestClaims(t, now.Add(-20*time.Minute), now.Add(2*time.Minute), WithSessionExpiry(now.Add(2*time.Minute)))
+	w := serveWithRenewal(t, ended)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, renewedCookie(w))
+}
+
+func TestAuthGinSlidingRenewalSources(t *testing.T) {
+	now := time.Now()
+	expiring := signTestClaims(t, now.Add(-27*time.Minute), now.Add(3*time.Minute))
+	renewal := WithSlidingRenewal(RenewalConfig{Window: 5 * time.Minute, MaxLifetime: time.Hour, Domain: "localhost"})
+
+	serve := func(req *http.Request, opts ...AuthOption) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(NewAuthGin(append([]AuthOption{WithSecretKey(secretKey), renewal}, opts...)...))
+		r.GET("/test", func(c *gin.Context) {
+			c.Status(200)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// The cookie configured with WithCookieName is rewritten
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: expiring})
+	w := serve(req, WithCookieName("session"))
+	require.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.NotEqual(t, expiring, cookies[0].Value)
+	assert.Empty(t, w.Header().Get(RenewedTokenHeader))
+
+	// A bearer token is renewed in the response header
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+expiring)
+	w = serve(req, WithTokenExtractors(FromBearer()))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+	renewed := w.Header().Get(RenewedTokenHeader)
+	require.NotEmpty(t, renewed)
+	claims, err := VerifyTokenClaims(renewed, newHMACKey(secretKey))
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+}
+
+func TestRenewTokenUsesTokenClock(t *testing.T) {
+	now := time.Now().Add(-time.Hour).Truncate(time.Second)
+	useTestTokenConfig(t, TokenConfig{TTL: 30 * time.Minute, Now: func() time.Time { return now }})
+
+	claims := &CustomClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now.Add(-28 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(2 * time.Minute)),
+		},
+	}
+	token, err := RenewToken(claims, newHMACKey(secretKey), time.Hour)
+	require.NoError(t, err)
+
+	renewed, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+	require.NoError(t, err)
+	assert.Equal(t, now, renewed.IssuedAt.Time)
+	assert.Equal(t, now.Add(30*time.Minute), renewed.ExpiresAt.Time)
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+	"github.com/google/uuid"
+)
+
+// RevocationStore records revoked token IDs and per-user revocation cut-off times
+type RevocationStore interface {
+	// RevokeToken records the token ID as revoked until the token expires
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// IsTokenRevoked reports whether the token ID has been revoked
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	// RevokeUser revokes every token issued to the user before the given time. The
+	// cut-off is kept for ttl, which must cover the lifetime of the user's tokens
+	RevokeUser(ctx context.Context, userID uuid.UUID, before time.Time, ttl time.Duration) error
+	// UserRevokedBefore returns the cut-off time of the user, zero when none is set
+	UserRevokedBefore(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+var (
+	revocationStore   RevocationStore
+	revocationStoreMu sync.RWMutex
+)
+
+// UseRevocationStore makes AuthGin and RefreshManager reject revoked tokens. nil disables the check
+func UseRevocationStore(store RevocationStore) {
+	revocationStoreMu.Lock()
+	defer revocationStoreMu.Unlock()
+	revocationStore = store
+}
+
+func getRevocationStore() RevocationStore {
+	revocationStoreMu.RLock()
+	defer revocationStoreMu.RUnlock()
+	return revocationStore
+}
+
+// RevokeToken verifies the token and records its ID as revoked until it expires, leeway
+// included, e.g. on logout
+func RevokeToken(ctx context.Context, store RevocationStore, tokenString string, verifier Verifier) error {
+	claims, err := VerifyTokenClaims(tokenString, verifier)
+	if err != nil {
+		return err
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return fmt.Errorf("token cannot be revoked")
+	}
+	return store.RevokeToken(ctx, claims.ID, acceptedUntil(claims.ExpiresAt.Time))
+}
+
+// RevokeUserTokens revokes every token issued to the user until now, e.g. on user.lock or user.disable.
+// The cut-off is kept for ttl, the longest lifetime of the user's tokens, e.g. RefreshManager.TTL,
+// plus the leeway. It defaults to DefaultRefreshTokenTTL and never drops below the access token TTL
+func RevokeUserTokens(ctx context.Context, store RevocationStore, userID uuid.UUID, ttl time.Duration) error {
+	cfg := getTokenConfig()
+	if ttl <= 0 {
+		ttl = DefaultRefreshTokenTTL
+	}
+	return store.RevokeUser(ctx, userID, tokenNow(), max(ttl, cfg.TTL)+cfg.Leeway)
+}
+
+// IsTokenRevoked reports whether the token has been revoked by ID or by a user cut-off
+func IsTokenRevoked(ctx context.Context, store RevocationStore, claims *UserClaims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := store.IsTokenRevoked(ctx, claims.ID)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	if claims.IssuedAt == nil {
+		return false, nil
+	}
+	return isIssuedBeforeCutoff(ctx, store, claims.UserID, tokenIssuedAt(claims.IssuedAt.Time, claims.ID))
+}
+
+// isIssuedBeforeCutoff reports whether issuedAt is not after the user's revocation cut-off
+func isIssuedBeforeCutoff(ctx context.Context, store RevocationStore, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	before, err := store.UserRevokedBefore(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return !before.IsZero() && !issuedAt.After(before), nil
+}
+
+// newTokenID returns a UUIDv7 jti holding the issue time in milliseconds, so a token
+// issued in the second of a revocation cut-off can be told apart, see tokenIssuedAt
+func newTokenID(now time.Time) string {
+	id := uuid.Must(uuid.NewV7())
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(now.UnixMilli()))
+	copy(id[:6], ms[2:])
+	return id.String()
+}
+
+// tokenIssuedAt refines the iat of a token, which has a one second precision, with the
+// milliseconds of its UUIDv7 jti. Tokens with another jti keep the iat second, so they
+// are revoked by a cut-off in the second they were issued
+func tokenIssuedAt(iat time.Time, tokenID string) time.Time {
+	id, err := uuid.Parse(tokenID)
+	if err != nil || id.Version() != 7 {
+		return iat
+	}
+	var ms [8]byte
+	copy(ms[2:], id[:6])
+	issuedAt := time.UnixMilli(int64(binary.BigEndian.Uint64(ms[:])))
+	if issuedAt.Before(iat) || !issuedAt.Before(iat.Add(time.Second)) {
+		return iat
+	}
+	return issuedAt
+}
+
+// RedisRevocationStore stores revocations in Redis through the cache package
+type RedisRevocationStore struct{}
+
+// NewRedisRevocationStore returns a revocation store backed by Redis. cache.InitRedis must be called first
+func NewRedisRevocationStore() *RedisRevocationStore {
+	return &RedisRevocationStore{}
+}
+
+func revokedTokenKey(tokenID string) string {
+	return fmt.Sprintf("revoked_token:%s", tokenID)
+}
+
+func revokedUserKey(userID uuid.UUID) string {
+	return fmt.Sprintf("revoked_user:%s", userID)
+}
+
+// RevokeToken records the token ID as revoked until the token expires
+func (s *RedisRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := expiresAt.Sub(tokenNow())
+	if ttl <= 0 {
+		// Already expired, nothing to revoke
+		return nil
+	}
+	return cache.SetRedisDataTTL(ctx, revokedTokenKey(tokenID), true, ttl)
+}
+
+// IsTokenRevoked reports whether the token ID has been revoked
+func (s *RedisRevocationStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return cache.ExistsRedisData(ctx, revokedTokenKey(tokenID))
+}
+
+// RevokeUser revokes every token issued to the user before the given time
+func (s *RedisRevocationStore) RevokeUser(ctx context.Context, userID uuid.UUID, before time.Time, ttl time.Duration) error {
+	return cache.SetRedisDataTTL(ctx, revokedUserKey(userID), before.UnixMilli(), ttl)
+}
+
+// UserRevokedBefore returns the cut-off time of the user, zero when none is set
+func (s *RedisRevocationStore) UserRevokedBefore(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	exists, err := cache.ExistsRedisData(ctx, revokedUserKey(userID))
+	if err != nil || !exists {
+		return time.Time{}, err
+	}
+	before, err := cache.GetRedisData[int64](ctx, revokedUserKey(userID))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(before), nil
+}
+
+// MemoryRevocationStore keeps revocations in process memory. It is meant for tests
+type MemoryRevocationStore struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+	users  map[uuid.UUID]memoryCutoff
+}
+
+type memoryCutoff struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+// NewMemoryRevocationStore returns an empty in-memory revocation store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[uuid.UUID]memoryCutoff),
+	}
+}
+
+// RevokeToken records the token ID as revoked until the token expires
+func (s *MemoryRevocationStore) RevokeToken(_ context.Context, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[tokenID] = expiresAt
+	return nil
+}
+
+// IsTokenRevoked reports whether the token ID has been revoked
+func (s *MemoryRevocationStore) IsTokenRevoked(_ context.Context, tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, ok := s.tokens[tokenID]
+	if ok && tokenNow().After(expiresAt) {
+		delete(s.tokens, tokenID)
+		return false, nil
+	}
+	return ok, nil
+}
+
+// RevokeUser revokes every token issued to the user before the given time
+func (s *MemoryRevocationStore) RevokeUser(_ context.Context, userID uuid.UUID, before time.Time, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[userID] = memoryCutoff{before: before, expiresAt: tokenNow().Add(ttl)}
+	return nil
+}
+
+// UserRevokedBefore returns the cut-off time of the user, zero when none is set
+func (s *MemoryRevocationStore) UserRevokedBefore(_ context.Context, userID uuid.UUID) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff, ok := s.users[userID]
+	if !ok || tokenNow().After(cutoff.expiresAt) {
+		return time.Time{}, nil
+	}
+	return cutoff.before, nil
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestRevocationStore installs an in-memory revocation store for the duration of the test
+func useTestRevocationStore(t *testing.T) *MemoryRevocationStore {
+	store := NewMemoryRevocationStore()
+	UseRevocationStore(store)
+	t.Cleanup(func() { UseRevocationStore(nil) })
+	return store
+}
+
+func serveAuthRequest(t *testing.T, token string) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthGin(secretKey))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"message": "success"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: "ftk", Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestGenerateTokenSetsJTI(t *testing.T) {
+	first, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	second, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	firstClaims, err := VerifyTokenClaims(first, newHMACKey(secretKey))
+	require.NoError(t, err)
+	secondClaims, err := VerifyTokenClaims(second, newHMACKey(secretKey))
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, firstClaims.ID)
+	assert.NotEqual(t, firstClaims.ID, secondClaims.ID)
+}
+
+func TestAuthGinRejectsRevokedToken(t *testing.T) {
+	store := useTestRevocationStore(t)
+	ctx := context.Background()
+
+	token, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	other, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serveAuthRequest(t, token))
+
+	require.NoError(t, RevokeToken(ctx, store, token, newHMACKey(secretKey)))
+
+	assert.Equal(t, http.StatusUnauthorized, serveAuthRequest(t, token))
+	assert.Equal(t, http.StatusOK, serveAuthRequest(t, other), "other sessions are not affected")
+}
+
+func TestAuthGinRejectsRevokedUser(t *testing.T) {
+	store := useTestRevocationStore(t)
+	ctx := context.Background()
+	otherUserID := uuid.New()
+
+	token, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	otherToken, err := GenerateToken(otherUserID, secretKey)
+	require.NoError(t, err)
+
+	require.NoError(t, RevokeUserTokens(ctx, store, userID, 0))
+
+	assert.Equal(t, http.StatusUnauthorized, serveAuthRequest(t, token))
+	assert.Equal(t, http.StatusOK, serveAuthRequest(t, otherToken))
+
+	// Tokens issued after the cut-off are accepted again
+	require.NoError(t, store.RevokeUser(ctx, userID, time.Now().Add(-time.Minute), time.Hour))
+	fresh, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serveAuthRequest(t, fresh))
+}
+
+func TestRefreshRotateRejectsRevokedUser(t *testing.T) {
+	store := useTestRevocationStore(t)
+	ctx := context.Background()
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), time.Hour)
+
+	pair, err := manager.Issue(ctx, userID)
+	require.NoError(t, err)
+
+	require.NoError(t, RevokeUserTokens(ctx, store, userID, 0))
+
+	_, err = manager.Rotate(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestMemoryRevocationStoreExpiry(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	ctx := context.Background()
+
+	require.NoError(t, store.RevokeToken(ctx, "expired", time.Now().Add(-time.Second)))
+	revoked, err := store.IsTokenRevoked(ctx, "expired")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, store.RevokeUser(ctx, userID, time.Now(), -time.Second))
+	before, err := store.UserRevokedBefore(ctx, userID)
+	assert.NoError(t, err)
+	assert.True(t, before.IsZero())
+}
+
+func TestRevokeTokenRejectsInvalidToken(t *testing.T) {
+	err := RevokeToken(context.Background(), NewMemoryRevocationStore(), "invalid_token", newHMACKey(secretKey))
+	assert.Error(t, err)
+}
+
+func TestRevokeUserTokensSameSecond(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	now := time.Now().Truncate(time.Second).Add(300 * time.Millisecond)
+	useTestTokenConfig(t, TokenConfig{Now: func() time.Time { return now }})
+
+	before, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	now = now.Add(200 * time.Millisecond)
+	require.NoError(t, RevokeUserTokens(ctx, store, userID, 0))
+	now = now.Add(200 * time.Millisecond)
+	after, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	isRevoked := func(token string) bool {
+		claims, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+		require.NoError(t, err)
+		revoked, err := IsTokenRevoked(ctx, store, claims)
+		require.NoError(t, err)
+		return revoked
+	}
+	assert.True(t, isRevoked(before))
+	assert.False(t, isRevoked(after), "a token issued after the cut-off in the same second is accepted")
+
+	// Tokens whose jti carries no issue time are revoked for the whole second
+	claims, err := VerifyTokenClaims(after, newHMACKey(secretKey))
+	require.NoError(t, err)
+	claims.ID = uuid.NewString()
+	revoked, err := IsTokenRevoked(ctx, store, claims)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestTokenIssuedAt(t *testing.T) {
+	now := time.UnixMilli(time.Now().UnixMilli())
+	iat := now.Truncate(time.Second)
+
+	assert.Equal(t, now, tokenIssuedAt(iat, newTokenID(now)))
+	assert.Equal(t, iat, tokenIssuedAt(iat, uuid.NewString()))
+	assert.Equal(t, iat, tokenIssuedAt(iat, "not-a-uuid"))
+	assert.Equal(t, iat, tokenIssuedAt(iat, newTokenID(now.Add(time.Hour))), "a jti outside the iat second is ignored")
+}
+
+func TestRevokeUserTokensKeepsCutoffForTTL(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	now := time.Now()
+	useTestTokenConfig(t, TokenConfig{Now: func() time.Time { return now }})
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), 30*24*time.Hour)
+
+	require.NoError(t, RevokeUserTokens(ctx, store, userID, manager.TTL()))
+	now = now.Add(DefaultRefreshTokenTTL + time.Hour)
+	before, err := store.UserRevokedBefore(ctx, userID)
+	require.NoError(t, err)
+	assert.False(t, before.IsZero(), "the cut-off outlives the default refresh token TTL")
+
+	now = now.Add(30 * 24 * time.Hour)
+	before, err = store.UserRevokedBefore(ctx, userID)
+	require.NoError(t, err)
+	assert.True(t, before.IsZero())
+}
@@ -7,8 +7,20 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// AuthCookieName is the name of the cookie holding the access token
+	AuthCookieName = "ftk"
+	// RefreshCookieName is the name of the cookie holding the refresh token
+	RefreshCookieName = "frt"
+)
+
 // SetSecureCookie sets a JWT token in a cookie with secure settings
 func SetSecureCookie(c *gin.Context, token string, domain string) {
+	http.SetCookie(c.Writer, newSecureCookie(c.Request, token, domain))
+}
+
+// newSecureCookie creates the ftk cookie holding the token
+func newSecureCookie(r *http.Request, token string, domain string) *http.Cookie {
 	var sameSite http.SameSite
 	// Create a new cookie with the token
 	if domain == "localhost" {
@@ -16,25 +28,17 @@ func SetSecureCookie(c *gin.Context, token string, domain string) {
 	} else {
 		sameSite = http.SameSiteNoneMode
 	}
-	cookie := &http.Cookie{
-		Name:     "ftk",
+	return &http.Cookie{
+		Name:     AuthCookieName,
 		Value:    token,
 		Path:     "/",
 		Domain:   domain,
-		MaxAge:   int(30 * time.Minute), // Match token expiration time
-		HttpOnly: true,                  // Prevent JavaScript access
+		MaxAge:   int(getTokenConfig().TTL.Seconds()), // Match token expiration time, in seconds
+		HttpOnly: true,                                // Prevent JavaScript access
 		SameSite: sameSite,
+		// Set Secure based on HTTPS usage
+		Secure: r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
 	}
-
-	// Set Secure based on HTTPS usage
-	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
-		cookie.Secure = true
-	} else {
-		cookie.Secure = false
-	}
-
-	// Set the cookie in the response
-	http.SetCookie(c.Writer, cookie)
 }
 
 // ClearAuthCookie clears the authentication cookie
@@ -47,7 +51,7 @@ func ClearAuthCookie(c *gin.Context, domain string) {
 		sameSite = http.SameSiteNoneMode
 	}
 	cookie := &http.Cookie{
-		Name:     "ftk",
+		Name:     AuthCookieName,
 		Value:    "",
 		Path:     "/",
 		Domain:   domain,
@@ -63,3 +67,36 @@ func ClearAuthCookie(c *gin.Context, domain string) {
 	}
 	http.SetCookie(c.Writer, cookie)
 }
+
+// SetRefreshCookie sets the refresh token in its own cookie, only sent to the given path
+func SetRefreshCookie(c *gin.Context, token string, domain string, path string, ttl time.Duration) {
+	http.SetCookie(c.Writer, newRefreshCookie(c, token, domain, path, int(ttl.Seconds())))
+}
+
+// ClearRefreshCookie clears the refresh token cookie set on the given path
+func ClearRefreshCookie(c *gin.Context, domain string, path string) {
+	http.SetCookie(c.Writer, newRefreshCookie(c, "", domain, path, -1))
+}
+
+// newRefreshCookie builds the refresh cookie with the same policy as the auth cookie
+func newRefreshCookie(c *gin.Context, token string, domain string, path string, maxAge int) *http.Cookie {
+	sameSite := http.SameSiteNoneMode
+	if domain == "localhost" {
+		sameSite = http.SameSiteLaxMode
+	}
+	return &http.Cookie{
+		Name:     RefreshCookieName,
+		Value:    token,
+		Path:     path,
+		Domain:   domain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: sameSite,
+	}
+}
+
+// GetRefreshCookie returns the refresh token sent in the refresh cookie
+func GetRefreshCookie(c *gin.Context) (string, error) {
+	return c.Cookie(RefreshCookieName)
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// ServiceTokenHeader is the message header carrying the service token
+	ServiceTokenHeader = "X-Service-Token"
+	// DefaultServiceTokenTTL is the lifetime of service tokens when none is given
+	DefaultServiceTokenTTL = 5 * time.Minute
+)
+
+var (
+	// ErrUnknownService is returned when the token is issued by a service without verification key
+	ErrUnknownService = errors.New("unknown service")
+	// ErrSubjectNotAllowed is returned when the service may not publish to the subject
+	ErrSubjectNotAllowed = errors.New("subject not allowed")
+)
+
+// ServiceClaims are the claims of a service-to-service token
+type ServiceClaims struct {
+	// Service is the name of the issuing service, e.g. "transaction"
+	Service string `json:"svc"`
+	// Subjects are the subjects the token may be used for, wildcards are allowed
+	Subjects []string `json:"subjects"`
+	jwt.RegisteredClaims
+}
+
+// GenerateServiceToken returns a token proving that the message is sent by the service.
+// Each service should sign with its own key so a compromised service cannot impersonate
+// the others. ttl <= 0 uses DefaultServiceTokenTTL
+func GenerateServiceToken(signer Signer, service string, subjects []string, ttl time.Duration) (string, error) {
+	if signer == nil || service == "" {
+		return "", fmt.Errorf("invalid service")
+	}
+	if len(subjects) == 0 {
+		return "", fmt.Errorf("at least one subject is required")
+	}
+	if ttl <= 0 {
+		ttl = DefaultServiceTokenTTL
+	}
+
+	now := tokenNow()
+	claims := ServiceClaims{
+		Service:          service,
+		Subjects:         slices.Clone(subjects),
+		RegisteredClaims: newRegisteredClaims(now),
+	}
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	return signer.Sign(claims)
+}
+
+// SetServiceToken attaches the token to message headers, e.g. a nats.Header
+func SetServiceToken(header map[string][]string, token string) {
+	header[ServiceTokenHeader] = []string{token}
+}
+
+// ServiceTokenFromHeader returns the token attached to message headers, empty when there is none
+func ServiceTokenFromHeader(header map[string][]string) string {
+	if values := header[ServiceTokenHeader]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ServiceACL lists the subjects each service may publish to. Patterns follow the NATS
+// wildcards: "*" matches one token and ">" the remaining tokens, e.g.
+//
+//	ServiceACL{
+//		"transaction": {subject.SubjectWalletWithdraw, subject.SubjectWalletDeposit},
+//		"backoffice":  {"user.*", "wallet.>"},
+//	}
+type ServiceACL map[string][]string
+
+// Allows reports whether the service may publish to the subject
+func (acl ServiceACL) Allows(service, subject string) bool {
+	return matchAnySubject(acl[service], subject)
+}
+
+// ServiceAuthenticator verifies service tokens against the key of each service and the ACL
+type ServiceAuthenticator struct {
+	acl  ServiceACL
+	keys map[string]Verifier
+}
+
+// NewServiceAuthenticator creates an authenticator checking the token of each service
+// with its verifier, e.g. the public key of the service
+func NewServiceAuthenticator(acl ServiceACL, keys map[string]Verifier) (*ServiceAuthenticator, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one service key is required")
+	}
+	for service, verifier := range keys {
+		if verifier == nil {
+			return nil, fmt.Errorf("missing key of service %q", service)
+		}
+	}
+	return &ServiceAuthenticator{acl: acl, keys: keys}, nil
+}
+
+// Verify checks that the token is valid, signed by the key of its service and that both
+// the token and the ACL allow the service to publish to the subject
+func (a *ServiceAuthenticator) Verify(tokenString, subject string) (*ServiceClaims, error) {
+	if tokenString == "" {
+		return nil, ErrMissingToken
+	}
+
+	// Read the service name to select its key, the claims are trusted only once verified
+	unverified, err := decryptToken(tokenString)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	peek := &ServiceClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(unverified, peek); err != nil {
+		return nil, ErrInvalidToken
+	}
+	verifier, ok := a.keys[peek.Service]
+	if !ok {
+		return nil, ErrUnknownService
+	}
+
+	claims := &ServiceClaims{}
+	if err := verifier.Verify(tokenString, claims); err != nil || claims.Service != peek.Service {
+		return nil, ErrInvalidToken
+	}
+	if !matchAnySubject(claims.Subjects, subject) || !a.acl.Allows(claims.Service, subject) {
+		return nil, ErrSubjectNotAllowed
+	}
+	return claims, nil
+}
+
+// VerifyHeader checks the token attached to message headers, see Verify
+func (a *ServiceAuthenticator) VerifyHeader(header map[string][]string, subject string) (*ServiceClaims, error) {
+	return a.Verify(ServiceTokenFromHeader(header), subject)
+}
+
+func matchAnySubject(patterns []string, subject string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		return matchSubject(pattern, subject)
+	})
+}
+
+// matchSubject matches a subject against a pattern with the NATS wildcards
+func matchSubject(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return i == len(patternTokens)-1 && len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
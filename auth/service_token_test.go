@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emmadal/feeti-module/subject"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServiceKey(t *testing.T) *Key {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewSigningKey(privateKey)
+	require.NoError(t, err)
+	return key
+}
+
+func TestServiceAuthenticator(t *testing.T) {
+	transactionKey := newTestServiceKey(t)
+	notificationKey := newTestServiceKey(t)
+
+	authenticator, err := NewServiceAuthenticator(
+		ServiceACL{
+			"transaction":  {subject.SubjectWalletWithdraw, subject.SubjectWalletDeposit},
+			"notification": {"notification.*"},
+		},
+		map[string]Verifier{
+			"transaction":  transactionKey.Public(),
+			"notification": notificationKey.Public(),
+		},
+	)
+	require.NoError(t, err)
+
+	token, err := GenerateServiceToken(transactionKey, "transaction", []string{"wallet.*"}, 0)
+	require.NoError(t, err)
+
+	header := map[string][]string{}
+	SetServiceToken(header, token)
+	claims, err := authenticator.VerifyHeader(header, subject.SubjectWalletWithdraw)
+	require.NoError(t, err)
+	assert.Equal(t, "transaction", claims.Service)
+
+	t.Run("Subject denied by the ACL", func(t *testing.T) {
+		_, err := authenticator.Verify(token, subject.SubjectWalletDisable)
+		assert.ErrorIs(t, err, ErrSubjectNotAllowed)
+	})
+
+	t.Run("Subject outside the token", func(t *testing.T) {
+		token, err := GenerateServiceToken(transactionKey, "transaction", []string{subject.SubjectWalletDeposit}, 0)
+		require.NoError(t, err)
+		_, err = authenticator.Verify(token, subject.SubjectWalletWithdraw)
+		assert.ErrorIs(t, err, ErrSubjectNotAllowed)
+	})
+
+	t.Run("Service impersonated with another key", func(t *testing.T) {
+		forged, err := GenerateServiceToken(notificationKey, "transaction", []string{subject.SubjectWalletWithdraw}, 0)
+		require.NoError(t, err)
+		_, err = authenticator.Verify(forged, subject.SubjectWalletWithdraw)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Unknown service", func(t *testing.T) {
+		token, err := GenerateServiceToken(newTestServiceKey(t), "backup", []string{">"}, 0)
+		require.NoError(t, err)
+		_, err = authenticator.Verify(token, subject.SubjectWalletWithdraw)
+		assert.ErrorIs(t, err, ErrUnknownService)
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		_, err := authenticator.VerifyHeader(map[string][]string{}, subject.SubjectWalletWithdraw)
+		assert.ErrorIs(t, err, ErrMissingToken)
+	})
+
+	t.Run("User token", func(t *testing.T) {
+		token, err := GenerateTokenWithSigner(userID, transactionKey)
+		require.NoError(t, err)
+		_, err = authenticator.Verify(token, subject.SubjectWalletWithdraw)
+		assert.ErrorIs(t, err, ErrUnknownService)
+	})
+}
+
+func TestServiceTokenRequiredJTI(t *testing.T) {
+	useTestTokenConfig(t, TokenConfig{RequiredClaims: []string{"exp", "jti"}})
+	key := newTestServiceKey(t)
+	authenticator, err := NewServiceAuthenticator(ServiceACL{"transaction": {"wallet.>"}}, map[string]Verifier{"transaction": key.Public()})
+	require.NoError(t, err)
+
+	token, err := GenerateServiceToken(key, "transaction", []string{"wallet.>"}, 0)
+	require.NoError(t, err)
+	_, err = authenticator.Verify(token, subject.SubjectWalletWithdraw)
+	assert.NoError(t, err, "service tokens carry a jti")
+}
+
+func TestServiceTokenRejectedAsSession(t *testing.T) {
+	key := newHMACKey(secretKey)
+	token, err := GenerateServiceToken(key, "transaction", []string{"wallet.>"}, 0)
+	require.NoError(t, err)
+
+	_, err = VerifyTokenClaims(token, key)
+	assert.Error(t, err, "a token without user is not a session")
+	_, err = VerifyToken(token, secretKey)
+	assert.Error(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/wallet", AuthGin(secretKey), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/wallet", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestMatchSubject(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		match            bool
+	}{
+		{"wallet.withdraw", "wallet.withdraw", true},
+		{"wallet.withdraw", "wallet.deposit", false},
+		{"wallet.*", "wallet.withdraw", true},
+		{"wallet.*", "wallet", false},
+		{"wallet.*", "wallet.withdraw.retry", false},
+		{"*.get", "user.get", true},
+		{"wallet.>", "wallet.withdraw.retry", true},
+		{"wallet.>", "wallet", false},
+		{">", "user.lock", true},
+		{"wallet.>.retry", "wallet.withdraw.retry", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, matchSubject(tt.pattern, tt.subject), "%s %s", tt.pattern, tt.subject)
+	}
+}
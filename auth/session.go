@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// DefaultSessionTouchInterval is how often the last-seen time of a session is written
+const DefaultSessionTouchInterval = time.Minute
+
+var (
+	// ErrSessionNotFound is returned when a session is unknown, expired or revoked
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionRevoked is returned by AuthGin when the session of the token has been revoked
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+// Session is a login of a user on a device
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     uuid.UUID `json:"userID"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// SessionStore persists the sessions of each user
+type SessionStore interface {
+	// Save stores the session until ttl elapses
+	Save(ctx context.Context, session Session, ttl time.Duration) error
+	// Get returns a session of the user, ErrSessionNotFound when it does not exist
+	Get(ctx context.Context, userID uuid.UUID, sessionID string) (Session, error)
+	// Touch updates the last-seen time of a session, ErrSessionNotFound when it does not exist
+	Touch(ctx context.Context, userID uuid.UUID, sessionID string, lastSeenAt time.Time) error
+	// List returns the sessions of the user
+	List(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	// Delete removes a session of the user, ErrSessionNotFound when it does not exist
+	Delete(ctx context.Context, userID uuid.UUID, sessionID string) error
+}
+
+// SessionRegistry records the sessions of the users so they can be listed and revoked
+type SessionRegistry struct {
+	store         SessionStore
+	ttl           time.Duration
+	touchInterval time.Duration
+}
+
+// NewSessionRegistry creates a session registry. A zero ttl falls back to DefaultRefreshTokenTTL,
+// sessions should live as long as the refresh tokens issued for them
+func NewSessionRegistry(store SessionStore, ttl time.Duration) *SessionRegistry {
+	if ttl <= 0 {
+		ttl = DefaultRefreshTokenTTL
+	}
+	return &SessionRegistry{store: store, ttl: ttl, touchInterval: DefaultSessionTouchInterval}
+}
+
+// TTL returns the lifetime of the sessions created by the registry
+func (r *SessionRegistry) TTL() time.Duration {
+	return r.ttl
+}
+
+// Create registers a new session for the user. The session ID must be added to the
+// tokens of the session with WithSessionID or RefreshManager.IssueForSession
+func (r *SessionRegistry) Create(ctx context.Context, userID uuid.UUID, device, ip, userAgent string) (Session, error) {
+	if userID == uuid.Nil {
+		return Session{}, fmt.Errorf("invalid user id")
+	}
+	now := tokenNow()
+	session := Session{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		Device:     device,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(r.ttl),
+	}
+	if err := r.store.Save(ctx, session, r.ttl); err != nil {
+		return Session{}, fmt.Errorf("failed to save session: %w", err)
+	}
+	return session, nil
+}
+
+// CreateFromGin registers a new session with the IP and user agent of the login request
+func (r *SessionRegistry) CreateFromGin(c *gin.Context, userID uuid.UUID, device string) (Session, error) {
+	return r.Create(c.Request.Context(), userID, device, c.ClientIP(), c.Request.UserAgent())
+}
+
+// Touch checks that the session is still active and refreshes its last-seen time.
+// The time is written at most once per touch interval to spare the store
+func (r *SessionRegistry) Touch(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	session, err := r.store.Get(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	now := tokenNow()
+	if now.Sub(session.LastSeenAt) < r.touchInterval {
+		return nil
+	}
+	return r.store.Touch(ctx, userID, sessionID, now)
+}
+
+// List returns the active sessions of the user, most recently seen first
+func (r *SessionRegistry) List(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	sessions, err := r.store.List(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// Revoke ends a session of the user, e.g. "log me out of my other phone"
+func (r *SessionRegistry) Revoke(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	return r.store.Delete(ctx, userID, sessionID)
+}
+
+// RevokeOthers ends every session of the user except the current one
+func (r *SessionRegistry) RevokeOthers(ctx context.Context, userID uuid.UUID, currentSessionID string) error {
+	return r.revokeAll(ctx, userID, currentSessionID)
+}
+
+// RevokeAll ends every session of the user, e.g. in the user.lock and user.disable subject handlers
+func (r *SessionRegistry) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	return r.revokeAll(ctx, userID, "")
+}
+
+func (r *SessionRegistry) revokeAll(ctx context.Context, userID uuid.UUID, keep string) error {
+	sessions, err := r.store.List(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if session.ID == keep {
+			continue
+		}
+		if err := r.store.Delete(ctx, userID, session.ID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetSessionIDFromGin retrieves the session ID of the authenticated token from the Gin context
+func GetSessionIDFromGin(c *gin.Context) string {
+	claims, ok := GetClaimsFromGin(c)
+	if !ok {
+		return ""
+	}
+	return claims.SessionID
+}
+
+// RedisSessionStore stores sessions in Redis through the cache package. Each session
+// has its own key and a set per user indexes the session IDs
+type RedisSessionStore struct{}
+
+// NewRedisSessionStore returns a session store backed by Redis. cache.InitRedis must be called first
+func NewRedisSessionStore() *RedisSessionStore {
+	return &RedisSessionStore{}
+}
+
+func sessionKey(userID uuid.UUID, sessionID string) string {
+	return fmt.Sprintf("session:%s:%s", userID, sessionID)
+}
+
+func userSessionsKey(userID uuid.UUID) string {
+	return fmt.Sprintf("sessions:%s", userID)
+}
+
+// Save stores the session until ttl elapses
+func (s *RedisSessionStore) Save(ctx context.Context, session Session, ttl time.Duration) error {
+	if err := cache.SetRedisDataTTL(ctx, sessionKey(session.UserID, session.ID), session, ttl); err != nil {
+		return err
+	}
+	// The newest session expires last, the index lives as long as it
+	return cache.AddRedisSetMembers(ctx, userSessionsKey(session.UserID), ttl, session.ID)
+}
+
+// Get returns a session of the user, ErrSessionNotFound when it does not exist
+func (s *RedisSessionStore) Get(ctx context.Context, userID uuid.UUID, sessionID string) (Session, error) {
+	exists, err := cache.ExistsRedisData(ctx, sessionKey(userID, sessionID))
+	if err != nil {
+		return Session{}, err
+	}
+	if !exists {
+		return Session{}, ErrSessionNotFound
+	}
+	return cache.GetRedisData[Session](ctx, sessionKey(userID, sessionID))
+}
+
+// Touch updates the last-seen time of a session, keeping its expiration
+func (s *RedisSessionStore) Touch(ctx context.Context, userID uuid.UUID, sessionID string, lastSeenAt time.Time) error {
+	session, err := s.Get(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	session.LastSeenAt = lastSeenAt
+	if err := cache.UpdateRedisData(ctx, sessionKey(userID, sessionID), session); err != nil {
+		// The session was revoked in the meantime
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// List returns the sessions of the user. Expired sessions are removed from the index
+func (s *RedisSessionStore) List(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	ids, err := cache.GetRedisSetMembers(ctx, userSessionsKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, 0, len(ids))
+	var expired []string
+	for _, id := range ids {
+		session, err := s.Get(ctx, userID, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			expired = append(expired, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := cache.RemoveRedisSetMembers(ctx, userSessionsKey(userID), expired...); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Delete removes a session of the user, ErrSessionNotFound when it does not exist
+func (s *RedisSessionStore) Delete(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	if err := cache.RemoveRedisSetMembers(ctx, userSessionsKey(userID), sessionID); err != nil {
+		return err
+	}
+	exists, err := cache.ExistsRedisData(ctx, sessionKey(userID, sessionID))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSessionNotFound
+	}
+	return cache.DeleteRedisData(ctx, sessionKey(userID, sessionID))
+}
+
+// MemorySessionStore keeps sessions in process memory. It is meant for tests
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]map[string]Session
+}
+
+// NewMemorySessionStore returns an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[uuid.UUID]map[string]Session)}
+}
+
+// Save stores the session until ttl elapses
+func (s *MemorySessionStore) Save(_ context.Context, session Session, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.ExpiresAt = tokenNow().Add(ttl)
+	if s.sessions[session.UserID] == nil {
+		s.sessions[session.UserID] = make(map[string]Session)
+	}
+	s.sessions[session.UserID][session.ID] = session
+	return nil
+}
+
+// Get returns a session of the user, ErrSessionNotFound when it does not exist
+func (s *MemorySessionStore) Get(_ context.Context, userID uuid.UUID, sessionID string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(userID, sessionID)
+}
+
+// Touch updates the last-seen time of a session
+func (s *MemorySessionStore) Touch(_ context.Context, userID uuid.UUID, sessionID string, lastSeenAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, err := s.get(userID, sessionID)
+	if err != nil {
+		return err
+	}
+	session.LastSeenAt = lastSeenAt
+	s.sessions[userID][sessionID] = session
+	return nil
+}
+
+// List returns the sessions of the user
+func (s *MemorySessionStore) List(_ context.Context, userID uuid.UUID) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]Session, 0, len(s.sessions[userID]))
+	for id := range s.sessions[userID] {
+		if session, err := s.get(userID, id); err == nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// Delete removes a session of the user, ErrSessionNotFound when it does not exist
+func (s *MemorySessionStore) Delete(_ context.Context, userID uuid.UUID, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.get(userID, sessionID); err != nil {
+		return err
+	}
+	delete(s.sessions[userID], sessionID)
+	return nil
+}
+
+func (s *MemorySessionStore) get(userID uuid.UUID, sessionID string) (Session, error) {
+	session, ok := s.sessions[userID][sessionID]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	if tokenNow().After(session.ExpiresAt) {
+		delete(s.sessions[userID], sessionID)
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveWithSessions(t *testing.T, registry *SessionRegistry, token string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewAuthGin(WithSecretKey(secretKey), WithSessionRegistry(registry)))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"session": GetSessionIDFromGin(c)})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSessionRegistryListAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	registry := NewSessionRegistry(NewMemorySessionStore(), time.Hour)
+
+	phone, err := registry.Create(ctx, userID, "Pixel 8", "10.0.0.1", "feeti-android/2.1")
+	require.NoError(t, err)
+	laptop, err := registry.Create(ctx, userID, "MacBook", "10.0.0.2", "Mozilla/5.0")
+	require.NoError(t, err)
+	_, err = registry.Create(ctx, uuid.New(), "Other user", "10.0.0.3", "Mozilla/5.0")
+	require.NoError(t, err)
+
+	sessions, err := registry.List(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, laptop.ID, sessions[0].ID, "most recently seen first")
+	assert.Equal(t, "Pixel 8", sessions[1].Device)
+	assert.Equal(t, "10.0.0.1", sessions[1].IP)
+
+	require.NoError(t, registry.Revoke(ctx, userID, phone.ID))
+	assert.ErrorIs(t, registry.Revoke(ctx, userID, phone.ID), ErrSessionNotFound)
+	assert.ErrorIs(t, registry.Touch(ctx, userID, phone.ID), ErrSessionNotFound)
+
+	sessions, err = registry.List(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, laptop.ID, sessions[0].ID)
+}
+
+func TestSessionRegistryRevokeAll(t *testing.T) {
+	ctx := context.Background()
+	registry := NewSessionRegistry(NewMemorySessionStore(), time.Hour)
+
+	current, err := registry.Create(ctx, userID, "Pixel 8", "10.0.0.1", "")
+	require.NoError(t, err)
+	_, err = registry.Create(ctx, userID, "Old phone", "10.0.0.2", "")
+	require.NoError(t, err)
+
+	require.NoError(t, registry.RevokeOthers(ctx, userID, current.ID))
+	sessions, err := registry.List(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, current.ID, sessions[0].ID)
+
+	require.NoError(t, registry.RevokeAll(ctx, userID))
+	sessions, err = registry.List(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestSessionRegistryTouch(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySessionStore()
+	registry := NewSessionRegistry(store, time.Hour)
+	registry.touchInterval = 0
+
+	session, err := registry.Create(ctx, userID, "Pixel 8", "", "")
+	require.NoError(t, err)
+
+	require.NoError(t, registry.Touch(ctx, userID, session.ID))
+	touched, err := store.Get(ctx, userID, session.ID)
+	require.NoError(t, err)
+	assert.True(t, touched.LastSeenAt.After(session.LastSeenAt))
+}
+
+func TestAuthGinWithSessionRegistry(t *testing.T) {
+	ctx := context.Background()
+	registry := NewSessionRegistry(NewMemorySessionStore(), time.Hour)
+
+	session, err := registry.Create(ctx, userID, "Pixel 8", "", "")
+	require.NoError(t, err)
+	token, err := GenerateToken(userID, secretKey, WithSessionID(session.ID))
+	require.NoError(t, err)
+	legacy, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	w := serveWithSessions(t, registry, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"session":"`+session.ID+`"}`, w.Body.String())
+
+	require.NoError(t, registry.RevokeAll(ctx, userID))
+
+	w = serveWithSessions(t, registry, token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"message":"Session revoked","success":false}`, w.Body.String())
+	assert.Equal(t, http.StatusOK, serveWithSessions(t, registry, legacy).Code, "tokens without session are not checked")
+}
+
+func TestRefreshManagerIssueForSession(t *testing.T) {
+	ctx := context.Background()
+	manager := NewRefreshManager(NewMemoryRefreshStore(), newHMACKey(secretKey), time.Hour)
+
+	pair, err := manager.IssueForSession(ctx, userID, "session-id")
+	require.NoError(t, err)
+	rotated, err := manager.Rotate(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+
+	for _, token := range []string{pair.AccessToken, rotated.AccessToken} {
+		claims, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+		require.NoError(t, err)
+		assert.Equal(t, "session-id", claims.SessionID)
+	}
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeySize is the smallest RSA modulus accepted for signing tokens
+const minRSAKeySize = 2048
+
+var (
+	// ErrVerifyOnlyKey is returned when signing with a key that only holds a public key
+	ErrVerifyOnlyKey = errors.New("key cannot sign tokens")
+	// ErrUnsupportedKey is returned for key types that cannot sign or verify tokens
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// Signer signs JWT claims into a compact token
+type Signer interface {
+	Sign(claims jwt.Claims) (string, error)
+}
+
+// Verifier checks the signature of a compact token and decodes its claims
+type Verifier interface {
+	Verify(tokenString string, claims jwt.Claims) error
+}
+
+// Parsers reused for every supported algorithm
+var parsers = map[string]*jwt.Parser{
+	jwt.SigningMethodHS256.Alg(): jwtParser,
+	jwt.SigningMethodRS256.Alg(): jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithoutClaimsValidation()),
+	jwt.SigningMethodES256.Alg(): jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}), jwt.WithoutClaimsValidation()),
+	jwt.SigningMethodES384.Alg(): jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodES384.Alg()}), jwt.WithoutClaimsValidation()),
+	jwt.SigningMethodES512.Alg(): jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodES512.Alg()}), jwt.WithoutClaimsValidation()),
+	jwt.SigningMethodEdDSA.Alg(): jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}), jwt.WithoutClaimsValidation()),
+}
+
+// Key is a JWT signing or verification key. It implements Signer and Verifier.
+// Asymmetric keys built from a public key only can verify but not sign tokens.
+type Key struct {
+	id         string
+	method     jwt.SigningMethod
+	signingKey any
+	verifyKey  any
+}
+
+// NewHMACKey returns an HS256 key for the given shared secret
+func NewHMACKey(secretKey []byte) (*Key, error) {
+	if len(secretKey) == 0 {
+		return nil, fmt.Errorf("invalid secret key")
+	}
+	return newHMACKey(secretKey), nil
+}
+
+func newHMACKey(secretKey []byte) *Key {
+	return &Key{method: jwt.SigningMethodHS256, signingKey: secretKey, verifyKey: secretKey}
+}
+
+// NewSigningKey returns a key signing with RS256, ES256/ES384/ES512 or EdDSA
+// depending on the type of the private key
+func NewSigningKey(privateKey crypto.Signer) (*Key, error) {
+	if privateKey == nil {
+		return nil, ErrUnsupportedKey
+	}
+	key, err := NewVerificationKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		key.signingKey = k
+	case ed25519.PrivateKey:
+		key.signingKey = k
+	case *ed25519.PrivateKey:
+		key.signingKey = *k
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return key, nil
+}
+
+// NewVerificationKey returns a key that only verifies tokens signed by the matching private key
+func NewVerificationKey(publicKey crypto.PublicKey) (*Key, error) {
+	var key *Key
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeySize {
+			return nil, fmt.Errorf("rsa key must be at least %d bits", minRSAKeySize)
+		}
+		key = &Key{method: jwt.SigningMethodRS256, verifyKey: k}
+	case *ecdsa.PublicKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		key = &Key{method: method, verifyKey: k}
+	case ed25519.PublicKey:
+		key = &Key{method: jwt.SigningMethodEdDSA, verifyKey: k}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	// Asymmetric keys are identified by their JWK thumbprint
+	thumbprint, err := key.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	key.id = thumbprint
+	return key, nil
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key
+func ParsePrivateKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM private key")
+	}
+
+	var privateKey any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	return NewSigningKey(signer)
+}
+
+// ParsePublicKeyPEM parses a PEM encoded PKIX public key or certificate
+func ParsePublicKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM public key")
+	}
+
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		return NewVerificationKey(cert.PublicKey)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return NewVerificationKey(publicKey)
+}
+
+// ID returns the key identifier stamped in the kid header of signed tokens
+func (k *Key) ID() string {
+	return k.id
+}
+
+// WithID returns a copy of the key identified by id, e.g. to name HMAC keys in a keyring
+func (k *Key) WithID(id string) *Key {
+	key := *k
+	key.id = id
+	return &key
+}
+
+// Algorithm returns the JWS algorithm of the key
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.signingKey != nil
+}
+
+// Public returns a copy of the key without its private material.
+// Symmetric keys cannot be made public and are returned as nil.
+func (k *Key) Public() *Key {
+	if k.method == jwt.SigningMethodHS256 {
+		return nil
+	}
+	return &Key{id: k.id, method: k.method, verifyKey: k.verifyKey}
+}
+
+// Sign signs the claims and stamps the key ID in the token header
+func (k *Key) Sign(claims jwt.Claims) (string, error) {
+	if k.signingKey == nil {
+		return "", ErrVerifyOnlyKey
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.id != "" {
+		token.Header["kid"] = k.id
+	}
+	signed, err := token.SignedString(k.signingKey)
+	if err != nil {
+		return "", err
+	}
+	return encryptToken(signed)
+}
+
+// Verify checks the token signature and decodes its payload into claims
+func (k *Key) Verify(tokenString string, claims jwt.Claims) error {
+	tokenString, err := decryptToken(tokenString)
+	if err != nil {
+		return fmt.Errorf("invalid token")
+	}
+	token, err := parsers[k.method.Alg()].ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (any, error) {
+			return k.verifyKey, nil
+		},
+	)
+	if err != nil || !token.Valid || validateClaims(claims) != nil {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+func ecdsaMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateTestSigners(t testing.TB) map[string]crypto.Signer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return map[string]crypto.Signer{
+		"RS256": rsaKey,
+		"ES256": ecKey,
+		"EdDSA": edKey,
+	}
+}
+
+func TestSigningKeys(t *testing.T) {
+	for alg, privateKey := range generateTestSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			key, err := NewSigningKey(privateKey)
+			require.NoError(t, err)
+			assert.Equal(t, alg, key.Algorithm())
+			assert.NotEmpty(t, key.ID())
+			assert.True(t, key.CanSign())
+
+			token, err := GenerateTokenWithSigner(userID, key)
+			require.NoError(t, err)
+
+			// The public part verifies but cannot sign
+			public := key.Public()
+			assert.False(t, public.CanSign())
+			id, err := VerifyTokenWithVerifier(token, public)
+			assert.NoError(t, err)
+			assert.Equal(t, userID, id)
+
+			_, err = GenerateTokenWithSigner(userID, public)
+			assert.ErrorIs(t, err, ErrVerifyOnlyKey)
+		})
+	}
+}
+
+func TestSigningKeyRejectsOtherKeys(t *testing.T) {
+	signers := generateTestSigners(t)
+	key, err := NewSigningKey(signers["ES256"])
+	require.NoError(t, err)
+	other, err := NewSigningKey(signers["RS256"])
+	require.NoError(t, err)
+
+	token, err := GenerateTokenWithSigner(userID, key)
+	require.NoError(t, err)
+
+	_, err = VerifyTokenWithVerifier(token, other)
+	assert.Error(t, err)
+
+	// An HS256 token signed with a public key must never be accepted
+	hmacToken, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	_, err = VerifyTokenWithVerifier(hmacToken, key.Public())
+	assert.Error(t, err)
+}
+
+func TestNewSigningKeyRejectsWeakRSA(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	_, err = NewSigningKey(weak)
+	assert.Error(t, err)
+}
+
+func TestParsePEMKeys(t *testing.T) {
+	for alg, privateKey := range generateTestSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			require.NoError(t, err)
+			publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+			require.NoError(t, err)
+
+			key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+			require.NoError(t, err)
+			public, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+			require.NoError(t, err)
+			assert.Equal(t, key.ID(), public.ID())
+
+			token, err := GenerateTokenWithSigner(userID, key)
+			require.NoError(t, err)
+			_, err = VerifyTokenWithVerifier(token, public)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewHMACKey(t *testing.T) {
+	_, err := NewHMACKey(nil)
+	assert.Error(t, err)
+
+	key, err := NewHMACKey(secretKey)
+	require.NoError(t, err)
+	assert.Nil(t, key.Public())
+
+	token, err := GenerateTokenWithSigner(userID, key)
+	require.NoError(t, err)
+	_, err = VerifyToken(token, secretKey)
+	assert.NoError(t, err)
+}
+
+func BenchmarkVerifyTokenES256(b *testing.B) {
+	key, err := NewSigningKey(generateTestSigners(b)["ES256"])
+	if err != nil {
+		b.Fatal(err)
+	}
+	token, err := GenerateTokenWithSigner(userID, key)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, err := VerifyTokenWithVerifier(token, key)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
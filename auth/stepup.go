@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	helpers "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Authentication methods carried in the amr claim, as registered by RFC 8176
+const (
+	AuthMethodPassword = "pwd"
+	AuthMethodOTP      = "otp"
+	AuthMethodSMS      = "sms"
+	AuthMethodPIN      = "pin"
+)
+
+// StepUpRequiredCode is the code returned by RequireStepUp telling the client to prompt for a second factor
+const StepUpRequiredCode = "step_up_required"
+
+// ErrStepUpRequired is returned when a route requires a recent second factor
+var ErrStepUpRequired = errors.New("step-up authentication required")
+
+// WithAuthMethods records how and when the user logged in, e.g. WithAuthMethods(time.Now(), AuthMethodPassword)
+func WithAuthMethods(authTime time.Time, methods ...string) ClaimsOption {
+	return func(claims *CustomClaims) {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+		claims.AuthMethods = append(claims.AuthMethods, methods...)
+	}
+}
+
+// StepUpToken upgrades the session of the claims after a successful OTP or PIN check.
+// It reissues the token with the methods added to amr and the step-up time set to now
+func StepUpToken(claims *CustomClaims, signer Signer, methods ...string) (string, error) {
+	if signer == nil || claims.UserID == uuid.Nil {
+		return "", fmt.Errorf("invalid user id")
+	}
+	if len(methods) == 0 {
+		return "", fmt.Errorf("no authentication method given")
+	}
+	// Admins never confirm a second factor on behalf of the user
+	if claims.IsImpersonated() {
+		return "", ErrImpersonationForbidden
+	}
+
+	now := tokenNow()
+	cfg := getTokenConfig()
+	upgraded := *claims
+	upgraded.AuthMethods = slices.Clone(claims.AuthMethods)
+	for _, method := range methods {
+		if !slices.Contains(upgraded.AuthMethods, method) {
+			upgraded.AuthMethods = append(upgraded.AuthMethods, method)
+		}
+	}
+	upgraded.StepUpAt = jwt.NewNumericDate(now)
+	upgraded.ID = newTokenID(now)
+	upgraded.IssuedAt = jwt.NewNumericDate(now)
+	upgraded.NotBefore = jwt.NewNumericDate(now)
+
+	// The upgraded token cannot outlive the session
+	expiresAt := now.Add(cfg.TTL)
+	if claims.SessionExpiresAt != nil && expiresAt.After(claims.SessionExpiresAt.Time) {
+		expiresAt = claims.SessionExpiresAt.Time
+	}
+	upgraded.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	return signer.Sign(upgraded)
+}
+
+// StepUpGin upgrades the session of the authenticated request, rewrites the ftk cookie
+// and returns the new token for clients sending it as a bearer. It must run after AuthGin
+func StepUpGin(c *gin.Context, signer Signer, domain string, methods ...string) (string, error) {
+	claims, ok := GetClaimsFromGin(c)
+	if !ok {
+		return "", ErrMissingToken
+	}
+	token, err := StepUpToken(claims, signer, methods...)
+	if err != nil {
+		return "", err
+	}
+	SetSecureCookie(c, token, domain)
+	return token, nil
+}
+
+// HasRecentStepUp reports whether the user confirmed a second factor within maxAge
+func (c *CustomClaims) HasRecentStepUp(maxAge time.Duration) bool {
+	if c.StepUpAt == nil || c.IsImpersonated() {
+		return false
+	}
+	return tokenNow().Sub(c.StepUpAt.Time) <= maxAge
+}
+
+// RequireStepUp is a middleware rejecting requests whose user did not confirm a second
+// factor within maxAge, e.g. on wallet.withdraw. The 401 response carries the code
+// step_up_required so the client prompts for an OTP. It must run after AuthGin.
+func RequireStepUp(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetClaimsFromGin(c)
+		if !ok {
+			c.Abort()
+			helpers.HandleError(c, http.StatusUnauthorized, "Unauthorized", ErrMissingToken)
+			return
+		}
+		if !claims.HasRecentStepUp(maxAge) {
+			c.Abort()
+			helpers.HandleErrorCode(c, http.StatusUnauthorized, "Step-up authentication required", StepUpRequiredCode, ErrStepUpRequired)
+			return
+		}
+		c.Next()
+	}
+}
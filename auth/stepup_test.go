@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepUpToken(t *testing.T) {
+	loginAt := time.Now().Add(-time.Minute)
+	token, err := GenerateToken(userID, secretKey, WithAuthMethods(loginAt, AuthMethodPassword), WithSessionID("session-id"))
+	require.NoError(t, err)
+	claims, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+	require.NoError(t, err)
+	assert.False(t, claims.HasRecentStepUp(5*time.Minute))
+
+	upgraded, err := StepUpToken(claims, newHMACKey(secretKey), AuthMethodOTP)
+	require.NoError(t, err)
+	upgradedClaims, err := VerifyTokenClaims(upgraded, newHMACKey(secretKey))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{AuthMethodPassword, AuthMethodOTP}, upgradedClaims.AuthMethods)
+	assert.Equal(t, loginAt.Unix(), upgradedClaims.AuthTime.Unix(), "the login time is kept")
+	assert.Equal(t, "session-id", upgradedClaims.SessionID)
+	assert.NotEqual(t, claims.ID, upgradedClaims.ID)
+	assert.True(t, upgradedClaims.HasRecentStepUp(5*time.Minute))
+
+	_, err = StepUpToken(claims, newHMACKey(secretKey))
+	assert.Error(t, err)
+}
+
+func TestRequireStepUp(t *testing.T) {
+	now := time.Now()
+	password, err := GenerateToken(userID, secretKey, WithAuthMethods(now, AuthMethodPassword))
+	require.NoError(t, err)
+	recent := signTestClaims(t, now, now.Add(30*time.Minute), func(claims *CustomClaims) {
+		claims.StepUpAt = jwt.NewNumericDate(now.Add(-time.Minute))
+	})
+	old := signTestClaims(t, now, now.Add(30*time.Minute), func(claims *CustomClaims) {
+		claims.StepUpAt = jwt.NewNumericDate(now.Add(-10 * time.Minute))
+	})
+
+	assert.Equal(t, http.StatusOK, serveWithGuard(t, recent, RequireStepUp(5*time.Minute)).Code)
+
+	for _, token := range []string{password, old} {
+		w := serveWithGuard(t, token, RequireStepUp(5*time.Minute))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.JSONEq(t, `{"message":"Step-up authentication required","success":false,"code":"step_up_required"}`, w.Body.String())
+	}
+}
+
+func TestStepUpGin(t *testing.T) {
+	token, err := GenerateToken(userID, secretKey, WithAuthMethods(time.Now(), AuthMethodPassword))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthGin(secretKey))
+	r.POST("/otp/check", func(c *gin.Context) {
+		// The OTP was checked by the handler
+		upgraded, err := StepUpGin(c, newHMACKey(secretKey), "localhost", AuthMethodOTP)
+		require.NoError(t, err)
+		c.JSON(200, gin.H{"token": upgraded})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/otp/check", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	cookie := renewedCookie(w)
+	require.NotNil(t, cookie)
+	assert.Equal(t, http.StatusOK, serveWithGuard(t, cookie.Value, RequireStepUp(time.Minute)).Code)
+}
+
+func TestStepUpUsesTokenClock(t *testing.T) {
+	now := time.Now().Add(-time.Hour).Truncate(time.Second)
+	useTestTokenConfig(t, TokenConfig{TTL: 10 * time.Minute, Now: func() time.Time { return now }})
+
+	claims := &CustomClaims{UserID: userID}
+	upgraded, err := StepUpToken(claims, newHMACKey(secretKey), AuthMethodOTP)
+	require.NoError(t, err)
+	upgradedClaims, err := VerifyTokenClaims(upgraded, newHMACKey(secretKey))
+	require.NoError(t, err)
+	assert.Equal(t, now, upgradedClaims.StepUpAt.Time)
+	assert.Equal(t, now.Add(10*time.Minute), upgradedClaims.ExpiresAt.Time)
+
+	assert.True(t, upgradedClaims.HasRecentStepUp(5*time.Minute))
+	now = now.Add(6 * time.Minute)
+	assert.False(t, upgradedClaims.HasRecentStepUp(5*time.Minute), "the step-up ages with the token clock")
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+	helpers "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultTicketTTL is the lifetime of connection tickets when none is given
+	DefaultTicketTTL = 30 * time.Second
+	// TicketQueryParam is the query parameter carrying the ticket of a WebSocket or SSE request
+	TicketQueryParam = "ticket"
+)
+
+// ErrInvalidTicket is returned when a ticket is unknown, expired or already used
+var ErrInvalidTicket = errors.New("invalid ticket")
+
+// TicketStore keeps the claims of the session each ticket was issued for
+type TicketStore interface {
+	// Save stores the claims under the ticket hash for ttl
+	Save(ctx context.Context, ticketHash string, claims *CustomClaims, ttl time.Duration) error
+	// Take returns and deletes the claims of the ticket hash. It returns ErrInvalidTicket
+	// when the ticket is unknown or expired
+	Take(ctx context.Context, ticketHash string) (*CustomClaims, error)
+}
+
+// TicketManager exchanges sessions for single-use tickets authenticating WebSocket
+// upgrades and SSE streams, which cannot carry headers or rely on the ftk cookie
+type TicketManager struct {
+	store TicketStore
+	ttl   time.Duration
+}
+
+// NewTicketManager creates a ticket manager. ttl <= 0 uses DefaultTicketTTL
+func NewTicketManager(store TicketStore, ttl time.Duration) *TicketManager {
+	if ttl <= 0 {
+		ttl = DefaultTicketTTL
+	}
+	return &TicketManager{store: store, ttl: ttl}
+}
+
+// Issue returns a ticket for the session of the claims. Only its hash is stored
+func (m *TicketManager) Issue(ctx context.Context, claims *CustomClaims) (string, error) {
+	if claims == nil {
+		return "", ErrMissingToken
+	}
+	ticket, err := generateTicket()
+	if err != nil {
+		return "", err
+	}
+	if err := m.store.Save(ctx, hashTicket(ticket), claims, m.ttl); err != nil {
+		return "", fmt.Errorf("failed to save ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// Redeem uses the ticket and returns the claims of its session. A ticket can be redeemed once
+func (m *TicketManager) Redeem(ctx context.Context, ticket string) (*CustomClaims, error) {
+	if ticket == "" {
+		return nil, ErrMissingToken
+	}
+	claims, err := m.store.Take(ctx, hashTicket(ticket))
+	if err != nil {
+		return nil, err
+	}
+	// The session may have expired since the ticket was issued
+	if claims.ExpiresAt != nil && tokenNow().After(claims.ExpiresAt.Time) {
+		return nil, ErrInvalidTicket
+	}
+	return claims, nil
+}
+
+// IssueTicketGin is the handler of the endpoint exchanging the session for a ticket.
+// It must run after AuthGin and responds with the ticket and its lifetime in seconds
+func IssueTicketGin(manager *TicketManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetClaimsFromGin(c)
+		if !ok {
+			c.Abort()
+			helpers.HandleError(c, http.StatusUnauthorized, "Unauthorized", ErrMissingToken)
+			return
+		}
+		ticket, err := manager.Issue(c.Request.Context(), claims)
+		if err != nil {
+			c.Abort()
+			helpers.HandleError(c, http.StatusInternalServerError, "Something went wrong", err)
+			return
+		}
+		helpers.HandleSuccessData(c, "Ticket issued", gin.H{
+			"ticket":    ticket,
+			"expiresIn": int(manager.ttl.Seconds()),
+		})
+	}
+}
+
+// TicketGin is a middleware authenticating WebSocket upgrades and SSE requests with the
+// ?ticket= query parameter. It attaches the user ID and claims exactly as AuthGin does and
+// accepts its options: revocations, sessions and impersonation are checked as well
+func TicketGin(manager *TicketManager, opts ...AuthOption) gin.HandlerFunc {
+	cfg := newAuthConfig(opts)
+
+	return func(c *gin.Context) {
+		claims, err := manager.Redeem(c.Request.Context(), c.Query(TicketQueryParam))
+		switch {
+		case errors.Is(err, ErrMissingToken):
+			cfg.onUnauthorized(c, http.StatusUnauthorized, err)
+			return
+		case errors.Is(err, ErrInvalidTicket):
+			cfg.onUnauthorized(c, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		case err != nil:
+			cfg.onUnauthorized(c, http.StatusInternalServerError, err)
+			return
+		}
+		if status, err := cfg.checkClaims(c.Request, claims); err != nil {
+			cfg.onUnauthorized(c, status, err)
+			return
+		}
+		cfg.serveGin(c, claims)
+	}
+}
+
+// generateTicket returns an opaque random ticket
+func generateTicket() (string, error) {
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("failed to generate ticket: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
+
+// hashTicket returns the hex encoded SHA-256 of the ticket
+func hashTicket(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
+
+// RedisTicketStore stores tickets in Redis through the cache package
+type RedisTicketStore struct{}
+
+// NewRedisTicketStore returns a ticket store backed by Redis. cache.InitRedis must be called first
+func NewRedisTicketStore() *RedisTicketStore {
+	return &RedisTicketStore{}
+}
+
+func ticketKey(ticketHash string) string {
+	return fmt.Sprintf("ticket:%s", ticketHash)
+}
+
+// Save stores the claims under the ticket hash for ttl
+func (s *RedisTicketStore) Save(ctx context.Context, ticketHash string, claims *CustomClaims, ttl time.Duration) error {
+	return cache.SetRedisDataTTL(ctx, ticketKey(ticketHash), claims, ttl)
+}
+
+// Take returns and deletes the claims of the ticket hash
+func (s *RedisTicketStore) Take(ctx context.Context, ticketHash string) (*CustomClaims, error) {
+	// GETDEL makes the ticket single-use even when redeemed concurrently
+	claims, found, err := cache.TakeRedisData[*CustomClaims](ctx, ticketKey(ticketHash))
+	if err != nil {
+		return nil, err
+	}
+	if !found || claims == nil {
+		return nil, ErrInvalidTicket
+	}
+	return claims, nil
+}
+
+// MemoryTicketStore keeps tickets in process memory. It is meant for tests
+type MemoryTicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]memoryTicket
+}
+
+type memoryTicket struct {
+	claims    *CustomClaims
+	expiresAt time.Time
+}
+
+// NewMemoryTicketStore returns an empty in-memory ticket store
+func NewMemoryTicketStore() *MemoryTicketStore {
+	return &MemoryTicketStore{tickets: make(map[string]memoryTicket)}
+}
+
+// Save stores the claims under the ticket hash for ttl
+func (s *MemoryTicketStore) Save(_ context.Context, ticketHash string, claims *CustomClaims, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickets[ticketHash] = memoryTicket{claims: claims, expiresAt: tokenNow().Add(ttl)}
+	return nil
+}
+
+// Take returns and deletes the claims of the ticket hash
+func (s *MemoryTicketStore) Take(_ context.Context, ticketHash string) (*CustomClaims, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ticket, ok := s.tickets[ticketHash]
+	delete(s.tickets, ticketHash)
+	if !ok || tokenNow().After(ticket.expiresAt) {
+		return nil, ErrInvalidTicket
+	}
+	return ticket.claims, nil
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketGin(t *testing.T) {
+	manager := NewTicketManager(NewMemoryTicketStore(), 0)
+	token, err := GenerateToken(userID, secretKey, WithRoles("admin"))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/tickets", AuthGin(secretKey), IssueTicketGin(manager))
+	r.GET("/notifications/stream", TicketGin(manager), func(c *gin.Context) {
+		assert.Equal(t, userID, GetUserIDFromGin(c))
+		assert.Equal(t, []string{"admin"}, GetRolesFromGin(c))
+		assert.Equal(t, userID, UserIDFromContext(c.Request.Context()))
+		c.Status(http.StatusOK)
+	})
+
+	// Exchange the session for a ticket
+	req := httptest.NewRequest(http.MethodPost, "/tickets", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Data struct {
+			Ticket    string `json:"ticket"`
+			ExpiresIn int    `json:"expiresIn"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.NotEmpty(t, body.Data.Ticket)
+	assert.Equal(t, 30, body.Data.ExpiresIn)
+
+	stream := func(ticket string) int {
+		req := httptest.NewRequest(http.MethodGet, "/notifications/stream?ticket="+ticket, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, stream(body.Data.Ticket))
+	assert.Equal(t, http.StatusUnauthorized, stream(body.Data.Ticket), "tickets are single-use")
+	assert.Equal(t, http.StatusUnauthorized, stream(""))
+	assert.Equal(t, http.StatusUnauthorized, stream("unknown"))
+
+	// Tickets cannot be issued without a session
+	req = httptest.NewRequest(http.MethodPost, "/tickets", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTicketExpiry(t *testing.T) {
+	ctx := context.Background()
+	manager := NewTicketManager(NewMemoryTicketStore(), time.Millisecond)
+	ticket, err := manager.Issue(ctx, &CustomClaims{UserID: userID})
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = manager.Redeem(ctx, ticket)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+}
+
+func TestTicketGinRevokedToken(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	manager := NewTicketManager(NewMemoryTicketStore(), 0)
+
+	token, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	claims, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+	require.NoError(t, err)
+	ticket, err := manager.Issue(ctx, claims)
+	require.NoError(t, err)
+
+	// The session is revoked between the ticket issue and the upgrade
+	require.NoError(t, RevokeToken(ctx, store, token, newHMACKey(secretKey)))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", TicketGin(manager, WithRevocationStore(store)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/ws?ticket="+ticket, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
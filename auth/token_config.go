@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultTokenTTL is the lifetime of the access tokens when none is configured
+const DefaultTokenTTL = 30 * time.Minute
+
+// TokenConfig configures the claims set by GenerateToken and the checks made when a
+// token is verified. Every service of a deployment shares the issuer, each API has
+// its own audience so a token minted for one is rejected by the others.
+type TokenConfig struct {
+	// TTL is the lifetime of the access tokens and of the ftk cookie. It defaults to DefaultTokenTTL
+	TTL time.Duration
+	// Issuer is set as iss and, when not empty, required on verification
+	Issuer string
+	// Audiences are set as aud and, when not empty, the token must carry at least one of them
+	Audiences []string
+	// Leeway tolerates clock skew between services when checking exp, nbf and iat
+	Leeway time.Duration
+	// RequiredClaims lists the claims a token must carry, among exp, iat, nbf, iss, aud and jti.
+	// sub is not supported, the tokens carry the user in userID
+	RequiredClaims []string
+	// Now replaces time.Now in the auth package, e.g. with a fake clock in tests: tokens,
+	// sessions, tickets, API keys, lockouts and the in-memory stores follow it. The TTLs
+	// of the cache package, Redis included, keep the real time
+	Now func() time.Time
+}
+
+var (
+	tokenConfig    = TokenConfig{TTL: DefaultTokenTTL}
+	tokenValidator = jwt.NewValidator()
+	tokenConfigMu  sync.RWMutex
+)
+
+// UseTokenConfig sets the configuration used by GenerateToken, VerifyToken, the keys,
+// keyrings and SetSecureCookie. It should be called once at startup
+func UseTokenConfig(cfg TokenConfig) error {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTokenTTL
+	}
+	if cfg.Leeway < 0 {
+		return fmt.Errorf("invalid token leeway")
+	}
+	for _, claim := range cfg.RequiredClaims {
+		if !slices.Contains([]string{"exp", "iat", "nbf", "iss", "aud", "jti"}, claim) {
+			return fmt.Errorf("unsupported required claim %q", claim)
+		}
+	}
+	cfg.Audiences = slices.Clone(cfg.Audiences)
+	cfg.RequiredClaims = slices.Clone(cfg.RequiredClaims)
+
+	opts := []jwt.ParserOption{jwt.WithLeeway(cfg.Leeway)}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if len(cfg.Audiences) > 0 {
+		opts = append(opts, jwt.WithAudience(cfg.Audiences...))
+	}
+	if slices.Contains(cfg.RequiredClaims, "exp") {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+	if slices.Contains(cfg.RequiredClaims, "iat") {
+		opts = append(opts, jwt.WithIssuedAt())
+	}
+	if cfg.Now != nil {
+		opts = append(opts, jwt.WithTimeFunc(cfg.Now))
+	}
+
+	tokenConfigMu.Lock()
+	defer tokenConfigMu.Unlock()
+	tokenConfig = cfg
+	tokenValidator = jwt.NewValidator(opts...)
+	return nil
+}
+
+// CurrentTokenConfig returns the token config in use, e.g. to restore it after a test
+func CurrentTokenConfig() TokenConfig {
+	return getTokenConfig()
+}
+
+func getTokenConfig() TokenConfig {
+	tokenConfigMu.RLock()
+	defer tokenConfigMu.RUnlock()
+	return tokenConfig
+}
+
+// tokenNow returns the current time of the token config
+func tokenNow() time.Time {
+	if now := getTokenConfig().Now; now != nil {
+		return now()
+	}
+	return time.Now()
+}
+
+// acceptedUntil returns the time until which a token expiring at exp passes validation,
+// the leeway included. Revocations and consumed tokens must be remembered that long
+func acceptedUntil(exp time.Time) time.Time {
+	return exp.Add(getTokenConfig().Leeway)
+}
+
+// newRegisteredClaims returns the registered claims of a token issued now
+func newRegisteredClaims(now time.Time) jwt.RegisteredClaims {
+	cfg := getTokenConfig()
+	claims := jwt.RegisteredClaims{
+		ID:        newTokenID(now),
+		Issuer:    cfg.Issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(cfg.TTL)),
+	}
+	if len(cfg.Audiences) > 0 {
+		claims.Audience = slices.Clone(cfg.Audiences)
+	}
+	return claims
+}
+
+// validateClaims checks the time based claims, issuer, audience and required claims
+// of a token whose signature has been verified
+func validateClaims(claims jwt.Claims) error {
+	tokenConfigMu.RLock()
+	validator, required := tokenValidator, tokenConfig.RequiredClaims
+	tokenConfigMu.RUnlock()
+
+	if err := validator.Validate(claims); err != nil {
+		return err
+	}
+	for _, claim := range required {
+		if !hasClaim(claims, claim) {
+			return fmt.Errorf("token is missing required claim %s", claim)
+		}
+	}
+	return nil
+}
+
+func hasClaim(claims jwt.Claims, claim string) bool {
+	switch claim {
+	case "exp":
+		exp, err := claims.GetExpirationTime()
+		return err == nil && exp != nil
+	case "iat":
+		iat, err := claims.GetIssuedAt()
+		return err == nil && iat != nil
+	case "nbf":
+		nbf, err := claims.GetNotBefore()
+		return err == nil && nbf != nil
+	case "iss":
+		iss, err := claims.GetIssuer()
+		return err == nil && iss != ""
+	case "aud":
+		aud, err := claims.GetAudience()
+		return err == nil && len(aud) > 0
+	case "jti":
+		return tokenID(claims) != ""
+	}
+	return false
+}
+
+// tokenID returns the jti of the claims, which jwt.Claims has no getter for. Any claims
+// type embedding jwt.RegisteredClaims is supported
+func tokenID(claims jwt.Claims) string {
+	switch c := claims.(type) {
+	case *jwt.RegisteredClaims:
+		return c.ID
+	case jwt.MapClaims:
+		id, _ := c["jti"].(string)
+		return id
+	}
+	v := reflect.Indirect(reflect.ValueOf(claims))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	field := v.FieldByName("RegisteredClaims")
+	if !field.IsValid() || !field.CanInterface() {
+		return ""
+	}
+	registered, _ := field.Interface().(jwt.RegisteredClaims)
+	return registered.ID
+}
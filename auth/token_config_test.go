@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestTokenConfig sets the token configuration for the duration of the test
+func useTestTokenConfig(t *testing.T, cfg TokenConfig) {
+	previous := CurrentTokenConfig()
+	require.NoError(t, UseTokenConfig(cfg))
+	t.Cleanup(func() { _ = UseTokenConfig(previous) })
+}
+
+func TestGenerateTokenWithTokenConfig(t *testing.T) {
+	useTestTokenConfig(t, TokenConfig{TTL: 10 * time.Minute, Issuer: "feeti", Audiences: []string{"wallet"}})
+
+	token, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	claims, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+	require.NoError(t, err)
+
+	assert.Equal(t, "feeti", claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{"wallet"}, claims.Audience)
+	assert.NotNil(t, claims.NotBefore)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), claims.ExpiresAt.Time, time.Second)
+}
+
+func TestVerifyTokenRejectsOtherAudience(t *testing.T) {
+	useTestTokenConfig(t, TokenConfig{Issuer: "feeti", Audiences: []string{"backoffice"}})
+	backoffice, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	useTestTokenConfig(t, TokenConfig{Issuer: "feeti", Audiences: []string{"wallet"}})
+	wallet, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+
+	_, err = VerifyToken(backoffice, secretKey)
+	assert.Error(t, err, "a backoffice token is rejected by the wallet API")
+	_, err = VerifyToken(wallet, secretKey)
+	assert.NoError(t, err)
+
+	useTestTokenConfig(t, TokenConfig{Issuer: "other", Audiences: []string{"wallet"}})
+	_, err = VerifyToken(wallet, secretKey)
+	assert.Error(t, err, "issuer mismatch")
+}
+
+func TestVerifyTokenLeeway(t *testing.T) {
+	now := time.Now()
+	expired := signTestClaims(t, now.Add(-time.Hour), now.Add(-10*time.Second))
+
+	_, err := VerifyToken(expired, secretKey)
+	assert.Error(t, err)
+
+	useTestTokenConfig(t, TokenConfig{Leeway: time.Minute})
+	_, err = VerifyToken(expired, secretKey)
+	assert.NoError(t, err, "clock skew is tolerated")
+}
+
+func TestVerifyTokenRequiredClaims(t *testing.T) {
+	token, err := newHMACKey(secretKey).Sign(CustomClaims{UserID: userID})
+	require.NoError(t, err)
+
+	_, err = VerifyToken(token, secretKey)
+	assert.NoError(t, err)
+
+	useTestTokenConfig(t, TokenConfig{RequiredClaims: []string{"exp", "jti"}})
+	_, err = VerifyToken(token, secretKey)
+	assert.Error(t, err)
+
+	token, err = GenerateToken(uuid.New(), secretKey)
+	require.NoError(t, err)
+	_, err = VerifyToken(token, secretKey)
+	assert.NoError(t, err)
+
+	assert.Error(t, UseTokenConfig(TokenConfig{RequiredClaims: []string{"unknown"}}))
+	assert.Error(t, UseTokenConfig(TokenConfig{RequiredClaims: []string{"sub"}}), "no token carries sub")
+}
+
+func TestHasClaimTokenID(t *testing.T) {
+	withID := jwt.RegisteredClaims{ID: "token-id"}
+	assert.True(t, hasClaim(&CustomClaims{RegisteredClaims: withID}, "jti"))
+	assert.True(t, hasClaim(&PurposeClaims{RegisteredClaims: withID}, "jti"))
+	assert.True(t, hasClaim(&ServiceClaims{RegisteredClaims: withID}, "jti"))
+	assert.True(t, hasClaim(&withID, "jti"))
+	assert.True(t, hasClaim(jwt.MapClaims{"jti": "token-id"}, "jti"))
+
+	assert.False(t, hasClaim(&ServiceClaims{}, "jti"))
+	assert.False(t, hasClaim(jwt.MapClaims{}, "jti"))
+	assert.False(t, hasClaim((*CustomClaims)(nil), "jti"))
+}
+
+func TestRevocationCoversLeeway(t *testing.T) {
+	ctx := context.Background()
+	useTestTokenConfig(t, TokenConfig{Leeway: time.Minute})
+	store := NewMemoryRevocationStore()
+
+	token, err := GenerateToken(userID, secretKey)
+	require.NoError(t, err)
+	claims, err := VerifyTokenClaims(token, newHMACKey(secretKey))
+	require.NoError(t, err)
+	require.NoError(t, RevokeToken(ctx, store, token, newHMACKey(secretKey)))
+
+	// The token passes validation for a minute after exp, so must its revocation
+	assert.Equal(t, claims.ExpiresAt.Add(time.Minute), store.tokens[claims.ID])
+}
+
+func TestConsumedTokenCoversLeeway(t *testing.T) {
+	ctx := context.Background()
+	useTestTokenConfig(t, TokenConfig{Leeway: time.Minute})
+	store := NewMemoryConsumedTokenStore()
+	manager, err := NewPurposeTokenManager(secretKey, store)
+	require.NoError(t, err)
+
+	token, err := manager.Generate(userID, PurposePasswordReset, "password-hash", 0)
+	require.NoError(t, err)
+	claims, err := manager.Consume(ctx, token, PurposePasswordReset, "password-hash")
+	require.NoError(t, err)
+	assert.Equal(t, claims.ExpiresAt.Add(time.Minute), store.tokens[claims.ID])
+}
+
+func TestSetSecureCookieMaxAge(t *testing.T) {
+	useTestTokenConfig(t, TokenConfig{TTL: 15 * time.Minute})
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	SetSecureCookie(c, "token", "localhost")
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, 15*60, cookies[0].MaxAge, "MaxAge is in seconds")
+}
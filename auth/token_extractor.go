@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TokenExtractor returns the token carried by the request, or an empty string when there is none
+type TokenExtractor func(r *http.Request) string
+
+// FromCookie extracts the token from the named cookie
+func FromCookie(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// FromBearer extracts the token from an "Authorization: Bearer <token>" header
+func FromBearer() TokenExtractor {
+	return func(r *http.Request) string {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+}
+
+// FromHeader extracts the token from the named header, e.g. for partner APIs
+func FromHeader(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(name))
+	}
+}
+
+// extractToken returns the first token found by the extractors
+func extractToken(r *http.Request, extractors []TokenExtractor) string {
+	for _, extract := range extractors {
+		if token := extract(r); token != "" {
+			return token
+		}
+	}
+	return ""
+}
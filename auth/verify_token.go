@@ -9,16 +9,19 @@ import (
 )
 
 // UserClaims defines a struct for JWT claims to avoid using MapClaims
-type UserClaims struct {
-	UserID uuid.UUID `json:"userID"`
-	jwt.RegisteredClaims
-}
+type UserClaims = CustomClaims
 
-// Global parser instance to be reused
-var jwtParser = jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+// Global parser instance to be reused. Claims are checked by validateClaims against the TokenConfig
+var jwtParser = jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithoutClaimsValidation())
 
 // VerifyToken verify the given token to get its payload.
 func VerifyToken(tokenString string, secretKey []byte) (uuid.UUID, error) {
+	// Decrypt the token when the encrypted-token mode is enabled
+	tokenString, err := decryptToken(tokenString)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid token")
+	}
+
 	// Create a claims instance to unmarshal into
 	claims := &UserClaims{}
 
@@ -31,10 +34,37 @@ func VerifyToken(tokenString string, secretKey []byte) (uuid.UUID, error) {
 		},
 	)
 
-	if err != nil || !token.Valid {
+	if err != nil || !token.Valid || validateClaims(claims) != nil || claims.UserID == uuid.Nil {
 		return uuid.Nil, fmt.Errorf("invalid token")
 	}
 
 	// Access userID directly from the struct
 	return claims.UserID, nil
 }
+
+// VerifyTokenWithVerifier verify the given token with the verifier to get its payload.
+// Services holding only a public key can verify tokens without being able to mint them.
+func VerifyTokenWithVerifier(tokenString string, verifier Verifier) (uuid.UUID, error) {
+	claims, err := VerifyTokenClaims(tokenString, verifier)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+// VerifyTokenClaims verify the given token with the verifier and returns all its claims.
+// Tokens without user, e.g. service tokens signed with the same key, are rejected
+func VerifyTokenClaims(tokenString string, verifier Verifier) (*UserClaims, error) {
+	if verifier == nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims := &UserClaims{}
+	if err := verifier.Verify(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.UserID == uuid.Nil {
+		return nil, fmt.Errorf("invalid token: missing user")
+	}
+	return claims, nil
+}
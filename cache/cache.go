@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the key does not exist in cache
+	ErrNotFound = errors.New("data not found in cache")
+	// ErrNotInitialized is returned by the package functions when no default cache is set
+	ErrNotInitialized = errors.New("cache is not initialized")
+	// ErrNotSupported is returned when the default cache does not implement the operation
+	ErrNotSupported = errors.New("operation not supported by cache")
+)
+
+// Cache stores JSON encoded values by key. Several instances can be used side by side,
+// e.g. one for the sessions and another for the rate limits
+type Cache interface {
+	// Get decodes the value stored at key into dest. It returns ErrNotFound when the key does not exist
+	Get(ctx context.Context, key string, dest any) error
+	// Set stores the value at key. 0 means no expiration
+	Set(ctx context.Context, key string, value any, ttl time.Duration) error
+	// Update replaces the value stored at key, preserving its TTL. It returns ErrNotFound when the key does not exist
+	Update(ctx context.Context, key string, value any) error
+	// Delete removes the key. It returns ErrNotFound when the key does not exist
+	Delete(ctx context.Context, key string) error
+	// Exists reports whether the key exists
+	Exists(ctx context.Context, key string) (bool, error)
+	// TTL returns the remaining lifetime of the key, 0 when it does not expire.
+	// It returns ErrNotFound when the key does not exist
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+// The optional operations of a cache, used by the package functions when the default cache implements them
+type (
+	nxSetter interface {
+		SetNX(ctx context.Context, key string, value any, ttl time.Duration) (bool, error)
+	}
+	taker interface {
+		Take(ctx context.Context, key string, dest any) (bool, error)
+	}
+	counter interface {
+		Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	}
+	setStore interface {
+		AddSetMembers(ctx context.Context, key string, ttl time.Duration, members ...string) error
+		SetMembers(ctx context.Context, key string) ([]string, error)
+		RemoveSetMembers(ctx context.Context, key string, members ...string) error
+	}
+	flusher interface {
+		FlushAll(ctx context.Context) error
+	}
+	compareDeleter interface {
+		CompareAndDelete(ctx context.Context, key string, value any) (bool, error)
+	}
+)
+
+var (
+	defaultCache   Cache
+	defaultCacheMu sync.RWMutex
+)
+
+// SetDefault sets the cache used by the package functions. InitRedis sets it to a Redis cache
+func SetDefault(c Cache) {
+	defaultCacheMu.Lock()
+	defer defaultCacheMu.Unlock()
+	defaultCache = c
+}
+
+// Default returns the cache used by the package functions, nil when none is set
+func Default() Cache {
+	defaultCacheMu.RLock()
+	defer defaultCacheMu.RUnlock()
+	return defaultCache
+}
+
+func getDefault() (Cache, error) {
+	c := Default()
+	if c == nil {
+		return nil, ErrNotInitialized
+	}
+	return c, nil
+}
+
+// getDefaultAs returns the default cache when it implements the operation I
+func getDefaultAs[I any]() (I, error) {
+	c, err := getDefault()
+	if err != nil {
+		var zero I
+		return zero, err
+	}
+	return as[I](c)
+}
+
+// as returns the cache when it implements the operation I
+func as[I any](c Cache) (I, error) {
+	impl, ok := c.(I)
+	if !ok {
+		var zero I
+		return zero, ErrNotSupported
+	}
+	return impl, nil
+}
+
+// Get returns the value stored at key in the cache
+func Get[T any](ctx context.Context, c Cache, key string) (T, error) {
+	var result T
+	if err := c.Get(ctx, key, &result); err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// notFound returns ErrNotFound with the key
+func notFound(key string) error {
+	return fmt.Errorf("%w for key %s", ErrNotFound, key)
+}
+
+// encode converts the value to JSON
+func encode(value any) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+	return data, nil
+}
+
+// decode converts JSON data from cache into dest
+func decode(data []byte, dest any) error {
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("failed to unmarshal data from cache: %w", err)
+	}
+	return nil
+}
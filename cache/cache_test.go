@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withDefault sets the default cache for the duration of the test
+func withDefault(t *testing.T, c Cache) {
+	previous := Default()
+	SetDefault(c)
+	t.Cleanup(func() { SetDefault(previous) })
+}
+
+func TestPackageFunctionsNotInitialized(t *testing.T) {
+	withDefault(t, nil)
+	ctx := context.Background()
+
+	_, err := GetRedisData[string](ctx, "key")
+	assert.ErrorIs(t, err, ErrNotInitialized)
+	_, _, err = TakeRedisData[string](ctx, "key")
+	assert.ErrorIs(t, err, ErrNotInitialized)
+	assert.ErrorIs(t, SetRedisData(ctx, "key", "value", 1), ErrNotInitialized)
+	assert.ErrorIs(t, UpdateRedisData(ctx, "key", "value"), ErrNotInitialized)
+	assert.ErrorIs(t, DeleteRedisData(ctx, "key"), ErrNotInitialized)
+	_, err = ExistsRedisData(ctx, "key")
+	assert.ErrorIs(t, err, ErrNotInitialized)
+	_, err = IncrRedisData(ctx, "key", time.Minute)
+	assert.ErrorIs(t, err, ErrNotInitialized)
+	assert.NoError(t, CloseRedis())
+	assert.Nil(t, ExportRedisClient())
+}
+
+// mapCache is a minimal cache without the optional operations
+type mapCache map[string][]byte
+
+func (m mapCache) Get(_ context.Context, key string, dest any) error {
+	data, ok := m[key]
+	if !ok {
+		return notFound(key)
+	}
+	return decode(data, dest)
+}
+
+func (m mapCache) Set(_ context.Context, key string, value any, _ time.Duration) error {
+	data, err := encode(value)
+	m[key] = data
+	return err
+}
+
+func (m mapCache) Update(ctx context.Context, key string, value any) error {
+	if _, ok := m[key]; !ok {
+		return notFound(key)
+	}
+	return m.Set(ctx, key, value, 0)
+}
+
+func (m mapCache) Delete(_ context.Context, key string) error {
+	if _, ok := m[key]; !ok {
+		return notFound(key)
+	}
+	delete(m, key)
+	return nil
+}
+
+func (m mapCache) Exists(_ context.Context, key string) (bool, error) {
+	_, ok := m[key]
+	return ok, nil
+}
+
+func (m mapCache) TTL(_ context.Context, key string) (time.Duration, error) {
+	if _, ok := m[key]; !ok {
+		return 0, notFound(key)
+	}
+	return 0, nil
+}
+
+func TestPackageFunctionsUseDefault(t *testing.T) {
+	withDefault(t, mapCache{})
+	ctx := context.Background()
+	value := RedisTest{Name: "default", Value: "default-value"}
+
+	assert.NoError(t, SetRedisData(ctx, "key", value, 1))
+	result, err := GetRedisData[RedisTest](ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, value, result)
+
+	assert.NoError(t, DeleteRedisData(ctx, "key"))
+	_, err = GetRedisData[RedisTest](ctx, "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, "data not found in cache for key key")
+
+	_, err = IncrRedisData(ctx, "counter", time.Minute)
+	assert.ErrorIs(t, err, ErrNotSupported, "Optional operations fail when the cache lacks them")
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// DefaultFallbackRetryInterval is how long a FallbackCache serves from its fallback cache
+// before probing the primary one again
+const DefaultFallbackRetryInterval = 5 * time.Second
+
+// FallbackCache serves from its fallback cache while the primary one is unreachable, e.g. a
+// memory cache standing in for Redis. Once the primary fails, the calls skip it and go to the
+// fallback until a single call probes it again, every RetryInterval.
+// Values written during an outage are only stored in the fallback cache, so revocations,
+// lockouts and counters are not shared between replicas and are lost once the primary
+// cache is back
+type FallbackCache struct {
+	primary  Cache
+	fallback Cache
+	// OnUnavailable, when set, is called with the error of the primary cache before falling back
+	OnUnavailable func(err error)
+	// RetryInterval is how long the primary cache is skipped after failing. It defaults
+	// to DefaultFallbackRetryInterval
+	RetryInterval time.Duration
+
+	mu sync.Mutex
+	// retryAt is when the primary cache is probed again, zero while it answers
+	retryAt time.Time
+	probing bool
+	now     func() time.Time
+}
+
+// NewFallbackCache returns a cache using fallback when primary cannot be reached
+func NewFallbackCache(primary, fallback Cache) *FallbackCache {
+	return &FallbackCache{primary: primary, fallback: fallback, now: time.Now}
+}
+
+// InitRedisWithFallback works like InitRedis but never fails because Redis is unreachable:
+// the default cache falls back to a memory cache until Redis answers again. It only fails
+// when the environment is not configured.
+//
+// The fallback fails open: during an outage each replica keeps its own revoked tokens,
+// lockout and rate limit counters and consumed tokens, which the other replicas ignore,
+// and they are forgotten once Redis is back. A token revoked during an outage is accepted
+// again afterwards, and attackers can spread their attempts over the replicas. Services
+// that cannot accept this should use InitRedis and fail while Redis is unreachable
+func InitRedisWithFallback() error {
+	onceRedisCache.Do(func() {
+		opts, err := OptionsFromEnv()
+		if err != nil {
+			initRedisErr = err
+			return
+		}
+		// The client connects lazily, so Redis may come up after the service
+		SetDefault(NewFallbackCache(newRedisCache(opts), NewMemoryCache()))
+	})
+	return initRedisErr
+}
+
+// isUnavailable reports whether the error means the cache cannot be reached,
+// as opposed to a missing key or a value that cannot be decoded
+func isUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, redis.ErrPoolTimeout) ||
+		errors.Is(err, io.EOF)
+}
+
+// fallbackDo runs the operation on the primary cache, then on the fallback one if the primary is
+// unreachable. While the primary is known to be unreachable it goes straight to the fallback
+func fallbackDo[T any](f *FallbackCache, op func(c Cache) (T, error)) (T, error) {
+	if !f.tryPrimary() {
+		return op(f.fallback)
+	}
+	result, err := op(f.primary)
+	if err == nil || !isUnavailable(err) {
+		f.setAvailable(true)
+		return result, err
+	}
+	f.setAvailable(false)
+	if f.OnUnavailable != nil {
+		f.OnUnavailable(err)
+	}
+	return op(f.fallback)
+}
+
+// tryPrimary reports whether the primary cache should be used: while it answers, or to
+// probe it once the retry interval elapsed. A single call probes at a time
+func (f *FallbackCache) tryPrimary() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.retryAt.IsZero() {
+		return true
+	}
+	if f.probing || f.clock().Before(f.retryAt) {
+		return false
+	}
+	f.probing = true
+	return true
+}
+
+// setAvailable records whether the primary cache answered
+func (f *FallbackCache) setAvailable(available bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.probing = false
+	if available {
+		f.retryAt = time.Time{}
+		return
+	}
+	interval := f.RetryInterval
+	if interval <= 0 {
+		interval = DefaultFallbackRetryInterval
+	}
+	f.retryAt = f.clock().Add(interval)
+}
+
+func (f *FallbackCache) clock() time.Time {
+	if f.now == nil {
+		return time.Now()
+	}
+	return f.now()
+}
+
+// fallbackErr is fallbackDo for the operations only returning an error
+func fallbackErr(f *FallbackCache, op func(c Cache) error) error {
+	_, err := fallbackDo(f, func(c Cache) (struct{}, error) {
+		return struct{}{}, op(c)
+	})
+	return err
+}
+
+// Get decodes the value stored at key into dest
+func (f *FallbackCache) Get(ctx context.Context, key string, dest any) error {
+	return fallbackErr(f, func(c Cache) error { return c.Get(ctx, key, dest) })
+}
+
+// Set stores the value at key. 0 means no expiration
+func (f *FallbackCache) Set(ctx context.Context, key string, value any, ttl time.Duration) error {
+	return fallbackErr(f, func(c Cache) error { return c.Set(ctx, key, value, ttl) })
+}
+
+// Update replaces the value stored at key, preserving its TTL
+func (f *FallbackCache) Update(ctx context.Context, key string, value any) error {
+	return fallbackErr(f, func(c Cache) error { return c.Update(ctx, key, value) })
+}
+
+// Delete removes the key
+func (f *FallbackCache) Delete(ctx context.Context, key string) error {
+	return fallbackErr(f, func(c Cache) error { return c.Delete(ctx, key) })
+}
+
+// Exists reports whether the key exists
+func (f *FallbackCache) Exists(ctx context.Context, key string) (bool, error) {
+	return fallbackDo(f, func(c Cache) (bool, error) { return c.Exists(ctx, key) })
+}
+
+// TTL returns the remaining lifetime of the key, 0 when it does not expire
+func (f *FallbackCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return fallbackDo(f, func(c Cache) (time.Duration, error) { return c.TTL(ctx, key) })
+}
+
+// Take decodes the value stored at key into dest and deletes it atomically
+func (f *FallbackCache) Take(ctx context.Context, key string, dest any) (bool, error) {
+	return fallbackDo(f, func(c Cache) (bool, error) {
+		t, err := as[taker](c)
+		if err != nil {
+			return false, err
+		}
+		return t.Take(ctx, key, dest)
+	})
+}
+
+// SetNX stores the value only if the key does not exist yet and reports whether it was stored
+func (f *FallbackCache) SetNX(ctx context.Context, key string, value any, ttl time.Duration) (bool, error) {
+	return fallbackDo(f, func(c Cache) (bool, error) {
+		s, err := as[nxSetter](c)
+		if err != nil {
+			return false, err
+		}
+		return s.SetNX(ctx, key, value, ttl)
+	})
+}
+
+// CompareAndDelete removes the key only if it holds the value
+func (f *FallbackCache) CompareAndDelete(ctx context.Context, key string, value any) (bool, error) {
+	return fallbackDo(f, func(c Cache) (bool, error) {
+		d, err := as[compareDeleter](c)
+		if err != nil {
+			return false, err
+		}
+		return d.CompareAndDelete(ctx, key, value)
+	})
+}
+
+// Incr increments the counter stored at key and returns its new value
+func (f *FallbackCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return fallbackDo(f, func(c Cache) (int64, error) {
+		n, err := as[counter](c)
+		if err != nil {
+			return 0, err
+		}
+		return n.Incr(ctx, key, ttl)
+	})
+}
+
+// AddSetMembers adds members to the set stored at key and resets its expiration
+func (f *FallbackCache) AddSetMembers(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	return fallbackErr(f, func(c Cache) error {
+		s, err := as[setStore](c)
+		if err != nil {
+			return err
+		}
+		return s.AddSetMembers(ctx, key, ttl, members...)
+	})
+}
+
+// SetMembers returns the members of the set stored at key
+func (f *FallbackCache) SetMembers(ctx context.Context, key string) ([]string, error) {
+	return fallbackDo(f, func(c Cache) ([]string, error) {
+		s, err := as[setStore](c)
+		if err != nil {
+			return nil, err
+		}
+		return s.SetMembers(ctx, key)
+	})
+}
+
+// RemoveSetMembers removes members from the set stored at key
+func (f *FallbackCache) RemoveSetMembers(ctx context.Context, key string, members ...string) error {
+	return fallbackErr(f, func(c Cache) error {
+		s, err := as[setStore](c)
+		if err != nil {
+			return err
+		}
+		return s.RemoveSetMembers(ctx, key, members...)
+	})
+}
+
+// FlushAll removes all items from both caches
+func (f *FallbackCache) FlushAll(ctx context.Context) error {
+	for _, c := range []Cache{f.primary, f.fallback} {
+		fl, err := as[flusher](c)
+		if err != nil {
+			return err
+		}
+		if err := fl.FlushAll(ctx); err != nil && !isUnavailable(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes both caches
+func (f *FallbackCache) Close() error {
+	var errs []error
+	for _, c := range []Cache{f.primary, f.fallback} {
+		if closer, ok := c.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
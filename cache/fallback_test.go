@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackCacheUnreachable(t *testing.T) {
+	ctx := context.Background()
+	// Nothing listens on port 1, every command fails to connect
+	primary := newRedisCache(Options{Addr: "127.0.0.1:1"})
+	fallback := NewMemoryCache()
+	f := NewFallbackCache(primary, fallback)
+	defer f.Close()
+
+	var unavailable int
+	f.OnUnavailable = func(err error) {
+		assert.True(t, isUnavailable(err))
+		unavailable++
+	}
+
+	value := RedisTest{Name: "fallback", Value: "fallback-value"}
+	require.NoError(t, f.Set(ctx, "key", value, time.Minute))
+	result, err := Get[RedisTest](ctx, f, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, value, result)
+	assert.Equal(t, 1, unavailable, "The primary cache is skipped once it failed")
+
+	// The values are served by the fallback cache
+	result, err = Get[RedisTest](ctx, fallback, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, value, result)
+
+	n, err := f.Incr(ctx, "counter", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.NoError(t, f.Delete(ctx, "key"))
+	_, err = Get[RedisTest](ctx, f, "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, f.FlushAll(ctx))
+}
+
+func TestFallbackCachePrimaryErrors(t *testing.T) {
+	ctx := context.Background()
+	primary := NewMemoryCache()
+	fallback := NewMemoryCache()
+	f := NewFallbackCache(primary, fallback)
+	f.OnUnavailable = func(err error) { t.Errorf("unexpected fallback: %v", err) }
+
+	// A reachable primary answers, even with a missing key
+	_, err := Get[string](ctx, f, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, f.Set(ctx, "key", "value", 0))
+	exists, err := fallback.Exists(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, exists, "The fallback cache is only used while the primary is unreachable")
+}
+
+func TestFallbackCacheAsDefault(t *testing.T) {
+	withDefault(t, NewFallbackCache(newRedisCache(Options{Addr: "127.0.0.1:1"}), NewMemoryCache()))
+	ctx := context.Background()
+
+	require.NoError(t, SetRedisDataTTL(ctx, "key", "value", time.Minute))
+	result, err := GetRedisData[string](ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", result)
+	assert.NotNil(t, ExportRedisClient(), "The client of the primary cache is exported")
+}
+
+// downCache fails to reach its server while down is set
+type downCache struct {
+	*MemoryCache
+	down  atomic.Bool
+	calls atomic.Int32
+}
+
+func (d *downCache) Get(ctx context.Context, key string, dest any) error {
+	d.calls.Add(1)
+	if d.down.Load() {
+		return io.EOF
+	}
+	return d.MemoryCache.Get(ctx, key, dest)
+}
+
+func TestFallbackCacheRetryInterval(t *testing.T) {
+	ctx := context.Background()
+	primary := &downCache{MemoryCache: NewMemoryCache()}
+	primary.down.Store(true)
+	require.NoError(t, primary.Set(ctx, "key", "primary", 0))
+	fallback := NewMemoryCache()
+	require.NoError(t, fallback.Set(ctx, "key", "fallback", 0))
+
+	now := time.Now()
+	f := NewFallbackCache(primary, fallback)
+	f.RetryInterval = time.Minute
+	f.now = func() time.Time { return now }
+
+	for range 3 {
+		result, err := Get[string](ctx, f, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "fallback", result)
+	}
+	assert.Equal(t, int32(1), primary.calls.Load(), "The primary cache is not retried before the interval")
+
+	// The probe fails and the primary cache is skipped for another interval
+	now = now.Add(time.Minute)
+	_, err := Get[string](ctx, f, "key")
+	require.NoError(t, err)
+	_, err = Get[string](ctx, f, "key")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), primary.calls.Load())
+
+	// The primary cache is used again once a probe succeeds
+	primary.down.Store(false)
+	now = now.Add(time.Minute)
+	for range 2 {
+		result, err := Get[string](ctx, f, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "primary", result)
+	}
+	assert.Equal(t, int32(4), primary.calls.Load())
+}
@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEarlyRefreshBeta favors refreshing the values a little before they expire
+	DefaultEarlyRefreshBeta = 1.0
+	// lockKeyPrefix prefixes the keys of the locks taken by GetOrLoad
+	lockKeyPrefix = "lock:"
+	// lockPollInterval is how often a replica waiting for a lock checks the cache
+	lockPollInterval = 25 * time.Millisecond
+)
+
+// Loader loads the value of a key missing from cache, e.g. from the database. It returns
+// an error wrapping ErrNotFound when the value does not exist
+type Loader[T any] func(ctx context.Context) (T, error)
+
+// LoadOption configures GetOrLoad
+type LoadOption func(*loadConfig)
+
+type loadConfig struct {
+	cache       Cache
+	negativeTTL time.Duration
+	lockTTL     time.Duration
+	beta        float64
+}
+
+// WithCache loads through the cache instead of the default one
+func WithCache(c Cache) LoadOption {
+	return func(cfg *loadConfig) {
+		cfg.cache = c
+	}
+}
+
+// WithNegativeTTL caches the values the loader does not find for ttl, so missing keys do not
+// reach the database on every call. It is disabled by default
+func WithNegativeTTL(ttl time.Duration) LoadOption {
+	return func(cfg *loadConfig) {
+		cfg.negativeTTL = ttl
+	}
+}
+
+// WithLock makes a single replica load a missing value: the others wait until it is cached,
+// at most ttl, before loading it themselves. ttl should exceed the time taken by the loader
+func WithLock(ttl time.Duration) LoadOption {
+	return func(cfg *loadConfig) {
+		cfg.lockTTL = ttl
+	}
+}
+
+// WithEarlyRefresh refreshes the values in the background before they expire, with a
+// probability growing as the expiry gets closer and the loader gets slower. A higher beta
+// refreshes earlier, see DefaultEarlyRefreshBeta
+func WithEarlyRefresh(beta float64) LoadOption {
+	return func(cfg *loadConfig) {
+		cfg.beta = beta
+	}
+}
+
+// loadEntry is the cached form of the values loaded by GetOrLoad
+type loadEntry[T any] struct {
+	Value T `json:"v"`
+	// NotFound marks a negative result
+	NotFound bool `json:"nf,omitempty"`
+	// Delta is the time taken by the loader, in nanoseconds
+	Delta int64 `json:"d"`
+	// Expiry is the expiration time in unix milliseconds, 0 when the value does not expire
+	Expiry int64 `json:"e,omitempty"`
+}
+
+// GetOrLoad returns the value stored at key, calling the loader and caching its result for ttl
+// on a miss. 0 means no expiration. Concurrent misses of a key in the same cache share a single
+// load in-process, the loaders of a key must be interchangeable.
+// When the cache cannot be reached the value is loaded on every call.
+//
+// Keys are stored with the load metadata, they must only be read through GetOrLoad
+func GetOrLoad[T any](ctx context.Context, key string, ttl time.Duration, loader Loader[T], opts ...LoadOption) (T, error) {
+	var zero T
+	cfg := loadConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.cache == nil {
+		c, err := getDefault()
+		if err != nil {
+			return zero, err
+		}
+		cfg.cache = c
+	}
+
+	var cached loadEntry[T]
+	err := cfg.cache.Get(ctx, key, &cached)
+	if err == nil {
+		if cached.NotFound {
+			return zero, notFound(key)
+		}
+		if cfg.shouldRefresh(cached.Delta, cached.Expiry) {
+			go func() {
+				_, _ = loads.do(context.WithoutCancel(ctx), newFlightKey[T](cfg.cache, key), func(ctx context.Context) (any, error) {
+					return load(ctx, cfg, key, ttl, loader)
+				})
+			}()
+		}
+		return cached.Value, nil
+	}
+	// Unreadable entries are replaced, errors of the cache leave the loader in charge
+
+	value, err := loads.do(ctx, newFlightKey[T](cfg.cache, key), func(ctx context.Context) (any, error) {
+		if cfg.lockTTL > 0 {
+			entry, cached, unlock := lockOrWait[T](ctx, cfg, key)
+			defer unlock()
+			if cached {
+				return entry, nil
+			}
+		}
+		return load(ctx, cfg, key, ttl, loader)
+	})
+	if err != nil {
+		return zero, err
+	}
+	entry := value.(loadEntry[T])
+	if entry.NotFound {
+		return zero, notFound(key)
+	}
+	return entry.Value, nil
+}
+
+// load calls the loader and caches its result
+func load[T any](ctx context.Context, cfg loadConfig, key string, ttl time.Duration, loader Loader[T]) (loadEntry[T], error) {
+	start := time.Now()
+	value, err := loader(ctx)
+	entry := loadEntry[T]{Value: value, Delta: int64(time.Since(start))}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		entry = loadEntry[T]{NotFound: true}
+		if cfg.negativeTTL > 0 {
+			_ = cfg.cache.Set(ctx, key, entry, cfg.negativeTTL)
+		}
+		return entry, nil
+	case err != nil:
+		return entry, err
+	}
+
+	if ttl > 0 {
+		entry.Expiry = time.Now().Add(ttl).UnixMilli()
+	}
+	// The value is returned even if it cannot be cached
+	_ = cfg.cache.Set(ctx, key, entry, ttl)
+	return entry, nil
+}
+
+// lockOrWait takes the lock of the key, to be released once the value is loaded. When
+// another replica holds it, it waits for the value that replica loads and reports whether
+// it was cached. It stops waiting when the lock expires or is released without a value
+func lockOrWait[T any](ctx context.Context, cfg loadConfig, key string) (entry loadEntry[T], cached bool, unlock func()) {
+	unlock = func() {}
+	locker, err := as[nxSetter](cfg.cache)
+	if err != nil {
+		return entry, false, unlock
+	}
+	lockKey := lockKeyPrefix + key
+	// The token proves the ownership of the lock, so a lock taken by another replica
+	// once this one expired is not released
+	token := crand.Text()
+	acquired, err := locker.SetNX(ctx, lockKey, token, cfg.lockTTL)
+	if err != nil {
+		return entry, false, unlock
+	}
+	if acquired {
+		return entry, false, func() { releaseLock(ctx, cfg.cache, lockKey, token) }
+	}
+
+	deadline := time.Now().Add(cfg.lockTTL)
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return entry, false, unlock
+		case <-ticker.C:
+		}
+		if err := cfg.cache.Get(ctx, key, &entry); err == nil {
+			return entry, true, unlock
+		}
+		// The holder failed or found nothing to cache
+		if held, err := cfg.cache.Exists(ctx, lockKey); err != nil || !held {
+			return loadEntry[T]{}, false, unlock
+		}
+	}
+	return loadEntry[T]{}, false, unlock
+}
+
+// releaseLock deletes the lock if it is still owned. Without compare-and-delete the lock
+// is left to expire
+func releaseLock(ctx context.Context, c Cache, lockKey, token string) {
+	if deleter, err := as[compareDeleter](c); err == nil {
+		_, _ = deleter.CompareAndDelete(ctx, lockKey, token)
+	}
+}
+
+// shouldRefresh decides whether a value is refreshed before it expires, following the
+// probabilistic early expiration of "Optimal Probabilistic Cache Stampede Prevention"
+func (cfg loadConfig) shouldRefresh(delta, expiry int64) bool {
+	if cfg.beta <= 0 || expiry == 0 {
+		return false
+	}
+	gap := float64(delta) * cfg.beta * -math.Log(1-rand.Float64())
+	return time.Now().Add(time.Duration(gap)).UnixMilli() >= expiry
+}
+
+// loads coalesces the concurrent loads of a key
+var loads = &flightGroup{}
+
+// flightKey identifies the loads of a key with a value type in a cache
+type flightKey struct {
+	cache any
+	typ   reflect.Type
+	key   string
+}
+
+func newFlightKey[T any](c Cache, key string) flightKey {
+	return flightKey{cache: cacheIdentity(c), typ: reflect.TypeFor[T](), key: key}
+}
+
+// cacheIdentity returns a comparable identity of the cache instance
+func cacheIdentity(c Cache) any {
+	v := reflect.ValueOf(c)
+	switch {
+	case v.Comparable():
+		return c
+	case v.Kind() == reflect.Map || v.Kind() == reflect.Slice || v.Kind() == reflect.Func:
+		return struct {
+			typ reflect.Type
+			ptr uintptr
+		}{v.Type(), v.Pointer()}
+	}
+	// The loads of a cache without identity are not shared
+	return new(byte)
+}
+
+type flight struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// flightGroup runs one function per key at a time, the callers of a running key share its result
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[flightKey]*flight
+}
+
+// do runs fn for the key, or waits for the run in progress. fn is not canceled with the
+// context of the caller since others may wait for it, the caller stops waiting instead
+func (g *flightGroup) do(ctx context.Context, key flightKey, fn func(ctx context.Context) (any, error)) (any, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[flightKey]*flight)
+	}
+	f, running := g.flights[key]
+	if !running {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+		go func() {
+			defer func() {
+				g.mu.Lock()
+				delete(g.flights, key)
+				g.mu.Unlock()
+				close(f.done)
+			}()
+			defer func() {
+				if r := recover(); r != nil {
+					f.err = fmt.Errorf("cache loader panicked: %v", r)
+				}
+			}()
+			f.value, f.err = fn(context.WithoutCancel(ctx))
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
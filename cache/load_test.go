@@ -0,0 +1,247 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingLoader returns a loader of the value counting its calls
+func countingLoader[T any](value T, err error, delay time.Duration) (Loader[T], *atomic.Int32) {
+	calls := &atomic.Int32{}
+	return func(ctx context.Context) (T, error) {
+		calls.Add(1)
+		time.Sleep(delay)
+		return value, err
+	}, calls
+}
+
+func TestGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMemoryCache()
+	value := RedisTest{Name: "wallet", Value: "1500"}
+	loader, calls := countingLoader(value, nil, 0)
+
+	for range 3 {
+		result, err := GetOrLoad(ctx, "wallet:1", time.Minute, loader, WithCache(m))
+		assert.NoError(t, err)
+		assert.Equal(t, value, result)
+	}
+	assert.Equal(t, int32(1), calls.Load(), "Hits should not call the loader")
+
+	ttl, err := m.TTL(ctx, "wallet:1")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+}
+
+func TestGetOrLoadDefaultCache(t *testing.T) {
+	ctx := context.Background()
+	loader, _ := countingLoader("value", nil, 0)
+
+	withDefault(t, nil)
+	_, err := GetOrLoad(ctx, "key", time.Minute, loader)
+	assert.ErrorIs(t, err, ErrNotInitialized)
+
+	withDefault(t, NewMemoryCache())
+	result, err := GetOrLoad(ctx, "key", time.Minute, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", result)
+}
+
+func TestGetOrLoadCoalescesMisses(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCache()
+	loader, calls := countingLoader(42, nil, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := GetOrLoad(ctx, "balance", time.Minute, loader, WithCache(m))
+			assert.NoError(t, err)
+			assert.Equal(t, 42, result)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load(), "Concurrent misses should share one load")
+}
+
+func TestGetOrLoadCoalescesPerCache(t *testing.T) {
+	ctx := context.Background()
+	sessions, rateLimits := NewMemoryCache(), NewMemoryCache()
+	sessionLoader, sessionCalls := countingLoader("session", nil, 50*time.Millisecond)
+	rateLimitLoader, rateLimitCalls := countingLoader("rate limit", nil, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		result, err := GetOrLoad(ctx, "user:1", time.Minute, sessionLoader, WithCache(sessions))
+		assert.NoError(t, err)
+		assert.Equal(t, "session", result)
+	}()
+	go func() {
+		defer wg.Done()
+		result, err := GetOrLoad(ctx, "user:1", time.Minute, rateLimitLoader, WithCache(rateLimits))
+		assert.NoError(t, err)
+		assert.Equal(t, "rate limit", result)
+	}()
+	wg.Wait()
+
+	assert.Equal(t, int32(1), sessionCalls.Load())
+	assert.Equal(t, int32(1), rateLimitCalls.Load(), "Loads of different caches are not shared")
+	result, err := Get[loadEntry[string]](ctx, rateLimits, "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "rate limit", result.Value)
+}
+
+func TestGetOrLoadErrors(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCache()
+	errDatabase := errors.New("database unavailable")
+	loader, calls := countingLoader(0, errDatabase, 0)
+
+	_, err := GetOrLoad(ctx, "key", time.Minute, loader, WithCache(m))
+	assert.ErrorIs(t, err, errDatabase)
+	_, err = GetOrLoad(ctx, "key", time.Minute, loader, WithCache(m))
+	assert.ErrorIs(t, err, errDatabase)
+	assert.Equal(t, int32(2), calls.Load(), "Errors should not be cached")
+
+	_, err = GetOrLoad(ctx, "panic", time.Minute, func(ctx context.Context) (int, error) {
+		panic("boom")
+	}, WithCache(m))
+	assert.ErrorContains(t, err, "boom")
+}
+
+func TestGetOrLoadNegativeTTL(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMemoryCache()
+	loader, calls := countingLoader("", fmt.Errorf("user: %w", ErrNotFound), 0)
+
+	_, err := GetOrLoad(ctx, "user:1", time.Minute, loader, WithCache(m))
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = GetOrLoad(ctx, "user:1", time.Minute, loader, WithCache(m))
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, int32(2), calls.Load(), "Negative results are not cached by default")
+
+	for range 2 {
+		_, err = GetOrLoad(ctx, "user:2", time.Minute, loader, WithCache(m), WithNegativeTTL(time.Second))
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, int32(3), calls.Load(), "Negative results should be cached")
+
+	ttl, err := m.TTL(ctx, "user:2")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, ttl, "Negative results use their own TTL")
+}
+
+func TestGetOrLoadLock(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCache()
+	loader, calls := countingLoader("loaded", nil, 0)
+
+	// Another replica holds the lock and caches the value
+	ok, err := m.SetNX(ctx, lockKeyPrefix+"key", true, time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = m.Set(ctx, "key", loadEntry[string]{Value: "other replica"}, time.Minute)
+	}()
+
+	result, err := GetOrLoad(ctx, "key", time.Minute, loader, WithCache(m), WithLock(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, "other replica", result)
+	assert.Equal(t, int32(0), calls.Load(), "The value loaded by the lock holder should be used")
+
+	// The lock holder never caches the value
+	_, _ = m.SetNX(ctx, lockKeyPrefix+"stale", true, 100*time.Millisecond)
+	result, err = GetOrLoad(ctx, "stale", time.Minute, loader, WithCache(m), WithLock(100*time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, "loaded", result)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// The lock is released once the value is loaded
+	result, err = GetOrLoad(ctx, "free", time.Minute, loader, WithCache(m), WithLock(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, "loaded", result)
+	exists, err := m.Exists(ctx, lockKeyPrefix+"free")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestGetOrLoadLockReleasedWithoutValue(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCache()
+	loader, calls := countingLoader("loaded", nil, 0)
+
+	// The lock holder fails to load and releases the lock
+	_, _ = m.SetNX(ctx, lockKeyPrefix+"key", "other replica", 5*time.Second)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = m.Delete(ctx, lockKeyPrefix+"key")
+	}()
+
+	start := time.Now()
+	result, err := GetOrLoad(ctx, "key", time.Minute, loader, WithCache(m), WithLock(5*time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, "loaded", result)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Less(t, time.Since(start), time.Second, "Waiting stops once the lock is released")
+}
+
+func TestGetOrLoadLockOwnership(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCache()
+	cfg := loadConfig{cache: m, lockTTL: time.Minute}
+
+	_, cached, unlock := lockOrWait[string](ctx, cfg, "key")
+	require.False(t, cached)
+
+	// The lock expired and another replica took it
+	require.NoError(t, m.Set(ctx, lockKeyPrefix+"key", "other replica", time.Minute))
+	unlock()
+	exists, err := m.Exists(ctx, lockKeyPrefix+"key")
+	assert.NoError(t, err)
+	assert.True(t, exists, "Only the owner releases the lock")
+}
+
+func TestGetOrLoadEarlyRefresh(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCache()
+	refreshed := make(chan struct{}, 1)
+	loader := func(ctx context.Context) (string, error) {
+		refreshed <- struct{}{}
+		return "fresh", nil
+	}
+
+	// A slow value about to expire
+	stale := loadEntry[string]{Value: "stale", Delta: int64(time.Hour), Expiry: time.Now().Add(time.Second).UnixMilli()}
+	require.NoError(t, m.Set(ctx, "key", stale, time.Second))
+
+	result, err := GetOrLoad(ctx, "key", time.Minute, loader, WithCache(m))
+	assert.NoError(t, err)
+	assert.Equal(t, "stale", result, "Values are not refreshed early by default")
+
+	result, err = GetOrLoad(ctx, "key", time.Minute, loader, WithCache(m), WithEarlyRefresh(DefaultEarlyRefreshBeta))
+	assert.NoError(t, err)
+	assert.Equal(t, "stale", result, "The cached value is served during the refresh")
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("the value should be refreshed in the background")
+	}
+	assert.Eventually(t, func() bool {
+		result, err := Get[loadEntry[string]](ctx, m, "key")
+		return err == nil && result.Value == "fresh"
+	}, time.Second, 10*time.Millisecond)
+}
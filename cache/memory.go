@@ -0,0 +1,302 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often expired items are removed from a memory cache
+const memorySweepInterval = time.Minute
+
+type memoryItem struct {
+	data      []byte
+	set       map[string]struct{}
+	expiresAt time.Time
+}
+
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && !now.Before(i.expiresAt)
+}
+
+// MemoryCache is an in-process cache with the semantics of RedisCache: values are JSON
+// encoded, keys expire and missing keys return ErrNotFound. It lets the services run
+// their tests without Redis:
+//
+//	cache.SetDefault(cache.NewMemoryCache())
+//
+// Its data is not shared between replicas
+type MemoryCache struct {
+	mu        sync.Mutex
+	items     map[string]memoryItem
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryCache returns an empty memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{items: make(map[string]memoryItem), now: time.Now}
+}
+
+// get returns the live item stored at key. It must be called with the lock held
+func (m *MemoryCache) get(key string) (memoryItem, bool) {
+	item, ok := m.items[key]
+	if ok && item.expired(m.now()) {
+		delete(m.items, key)
+		return memoryItem{}, false
+	}
+	return item, ok
+}
+
+// put stores the item, removing the expired ones from time to time. It must be called with the lock held
+func (m *MemoryCache) put(key string, item memoryItem) {
+	now := m.now()
+	if now.Sub(m.lastSweep) >= memorySweepInterval {
+		for k, i := range m.items {
+			if i.expired(now) {
+				delete(m.items, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	m.items[key] = item
+}
+
+func (m *MemoryCache) expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return m.now().Add(ttl)
+}
+
+// value returns the data of a string item, the items holding a set cannot be read as a value
+func value(key string, item memoryItem) ([]byte, error) {
+	if item.set != nil {
+		return nil, fmt.Errorf("failed to get data from cache: key %s holds a set", key)
+	}
+	return item.data, nil
+}
+
+// Get decodes the value stored at key into dest
+func (m *MemoryCache) Get(_ context.Context, key string, dest any) error {
+	m.mu.Lock()
+	item, ok := m.get(key)
+	m.mu.Unlock()
+	if !ok {
+		return notFound(key)
+	}
+	data, err := value(key, item)
+	if err != nil {
+		return err
+	}
+	return decode(data, dest)
+}
+
+// Take decodes the value stored at key into dest and deletes it atomically.
+// It reports false when the key does not exist
+func (m *MemoryCache) Take(_ context.Context, key string, dest any) (bool, error) {
+	m.mu.Lock()
+	item, ok := m.get(key)
+	if ok && item.set == nil {
+		delete(m.items, key)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	data, err := value(key, item)
+	if err != nil {
+		return false, err
+	}
+	return true, decode(data, dest)
+}
+
+// Set stores the value at key. 0 means no expiration
+func (m *MemoryCache) Set(_ context.Context, key string, value any, ttl time.Duration) error {
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(key, memoryItem{data: data, expiresAt: m.expiresAt(ttl)})
+	return nil
+}
+
+// SetNX stores the value only if the key does not exist yet and reports whether it was stored.
+// 0 means no expiration
+func (m *MemoryCache) SetNX(_ context.Context, key string, value any, ttl time.Duration) (bool, error) {
+	data, err := encode(value)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); ok {
+		return false, nil
+	}
+	m.put(key, memoryItem{data: data, expiresAt: m.expiresAt(ttl)})
+	return true, nil
+}
+
+// Update replaces the value stored at key, preserving its TTL
+func (m *MemoryCache) Update(_ context.Context, key string, value any) error {
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		return notFound(key)
+	}
+	m.items[key] = memoryItem{data: data, expiresAt: item.expiresAt}
+	return nil
+}
+
+// Delete removes the key
+func (m *MemoryCache) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); !ok {
+		return notFound(key)
+	}
+	delete(m.items, key)
+	return nil
+}
+
+// CompareAndDelete removes the key only if it holds the value and reports whether it was deleted
+func (m *MemoryCache) CompareAndDelete(_ context.Context, key string, value any) (bool, error) {
+	data, err := encode(value)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok || item.set != nil || !bytes.Equal(item.data, data) {
+		return false, nil
+	}
+	delete(m.items, key)
+	return true, nil
+}
+
+// Exists reports whether the key exists
+func (m *MemoryCache) Exists(_ context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.get(key)
+	return ok, nil
+}
+
+// TTL returns the remaining lifetime of the key, 0 when it does not expire
+func (m *MemoryCache) TTL(_ context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		return 0, notFound(key)
+	}
+	if item.expiresAt.IsZero() {
+		return 0, nil
+	}
+	return item.expiresAt.Sub(m.now()), nil
+}
+
+// Incr increments the counter stored at key and returns its new value.
+// The expiration is set when the counter is created. 0 means no expiration
+func (m *MemoryCache) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		m.put(key, memoryItem{data: []byte("1"), expiresAt: m.expiresAt(ttl)})
+		return 1, nil
+	}
+
+	n, err := strconv.ParseInt(string(item.data), 10, 64)
+	if err != nil || item.set != nil {
+		return 0, fmt.Errorf("failed to increment data in cache: key %s does not hold an integer", key)
+	}
+	n++
+	item.data = []byte(strconv.FormatInt(n, 10))
+	m.items[key] = item
+	return n, nil
+}
+
+// AddSetMembers adds members to the set stored at key and resets its expiration. 0 means no expiration
+func (m *MemoryCache) AddSetMembers(_ context.Context, key string, ttl time.Duration, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if ok && item.set == nil {
+		return fmt.Errorf("failed to add members to cache set: key %s does not hold a set", key)
+	}
+	if !ok {
+		item.set = make(map[string]struct{}, len(members))
+	}
+	for _, member := range members {
+		item.set[member] = struct{}{}
+	}
+	if ttl > 0 {
+		item.expiresAt = m.expiresAt(ttl)
+	}
+	m.put(key, item)
+	return nil
+}
+
+// SetMembers returns the members of the set stored at key, empty when the key does not exist
+func (m *MemoryCache) SetMembers(_ context.Context, key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		return []string{}, nil
+	}
+	if item.set == nil {
+		return nil, fmt.Errorf("failed to get members from cache set: key %s does not hold a set", key)
+	}
+	members := make([]string, 0, len(item.set))
+	for member := range item.set {
+		members = append(members, member)
+	}
+	slices.Sort(members)
+	return members, nil
+}
+
+// RemoveSetMembers removes members from the set stored at key
+func (m *MemoryCache) RemoveSetMembers(_ context.Context, key string, members ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok || len(members) == 0 {
+		return nil
+	}
+	if item.set == nil {
+		return fmt.Errorf("failed to remove members from cache set: key %s does not hold a set", key)
+	}
+	for _, member := range members {
+		delete(item.set, member)
+	}
+	// Like Redis, a set without members does not exist
+	if len(item.set) == 0 {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+// FlushAll removes all items
+func (m *MemoryCache) FlushAll(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = make(map[string]memoryItem)
+	return nil
+}
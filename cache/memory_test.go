@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMemoryCache returns a memory cache with a clock moved by the returned function
+func newTestMemoryCache() (*MemoryCache, func(time.Duration)) {
+	m := NewMemoryCache()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryCacheSetGet(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCache()
+	value := RedisTest{Name: "memory", Value: "memory-value"}
+
+	require.NoError(t, m.Set(ctx, "key", value, time.Minute))
+	result, err := Get[RedisTest](ctx, m, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, value, result)
+
+	_, err = Get[RedisTest](ctx, m, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, "data not found in cache for key missing")
+
+	_, err = Get[int](ctx, m, "key")
+	assert.Error(t, err, "Values are JSON decoded like with Redis")
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newTestMemoryCache()
+
+	require.NoError(t, m.Set(ctx, "key", "value", time.Minute))
+	require.NoError(t, m.Set(ctx, "forever", "value", 0))
+	ttl, err := m.TTL(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+	ttl, err = m.TTL(ctx, "forever")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ttl, "Keys without expiration have no TTL")
+
+	// Updates keep the expiration
+	advance(30 * time.Second)
+	require.NoError(t, m.Update(ctx, "key", "updated"))
+	ttl, err = m.TTL(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, ttl)
+
+	advance(30 * time.Second)
+	_, err = Get[string](ctx, m, "key")
+	assert.ErrorIs(t, err, ErrNotFound, "Expired keys are not found")
+	exists, err := m.Exists(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	_, err = m.TTL(ctx, "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, m.Update(ctx, "key", "value"), ErrNotFound)
+	assert.ErrorIs(t, m.Delete(ctx, "key"), ErrNotFound)
+
+	exists, err = m.Exists(ctx, "forever")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestMemoryCacheSweep(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newTestMemoryCache()
+
+	require.NoError(t, m.Set(ctx, "key", "value", time.Second))
+	advance(memorySweepInterval)
+	require.NoError(t, m.Set(ctx, "other", "value", 0))
+	assert.Len(t, m.items, 1, "Expired keys are removed even when never read again")
+}
+
+func TestMemoryCacheSetNXTake(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newTestMemoryCache()
+
+	ok, err := m.SetNX(ctx, "key", "first", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = m.SetNX(ctx, "key", "second", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok, "SetNX should not override the value")
+
+	var result string
+	found, err := m.Take(ctx, "key", &result)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "first", result)
+	found, err = m.Take(ctx, "key", &result)
+	assert.NoError(t, err)
+	assert.False(t, found, "A value can only be taken once")
+
+	// Expired keys are free again
+	_, _ = m.SetNX(ctx, "key", "first", time.Minute)
+	advance(time.Minute)
+	ok, err = m.SetNX(ctx, "key", "second", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestMemoryCacheIncr(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newTestMemoryCache()
+
+	for want := int64(1); want <= 3; want++ {
+		n, err := m.Incr(ctx, "counter", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+	count, err := Get[int](ctx, m, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	advance(time.Minute)
+	n, err := m.Incr(ctx, "counter", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n, "The expiration is set when the counter is created")
+
+	require.NoError(t, m.Set(ctx, "name", "feeti", 0))
+	_, err = m.Incr(ctx, "name", 0)
+	assert.Error(t, err)
+}
+
+func TestMemoryCacheSetMembers(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newTestMemoryCache()
+
+	require.NoError(t, m.AddSetMembers(ctx, "set", time.Minute, "a", "b"))
+	members, err := m.SetMembers(ctx, "set")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, members)
+
+	require.NoError(t, m.RemoveSetMembers(ctx, "set", "a"))
+	members, err = m.SetMembers(ctx, "set")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, members)
+
+	require.NoError(t, m.RemoveSetMembers(ctx, "set", "b"))
+	exists, err := m.Exists(ctx, "set")
+	assert.NoError(t, err)
+	assert.False(t, exists, "Empty sets do not exist")
+
+	require.NoError(t, m.AddSetMembers(ctx, "set", time.Minute, "c"))
+	advance(time.Minute)
+	members, err = m.SetMembers(ctx, "set")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+
+	require.NoError(t, m.Set(ctx, "value", "v", 0))
+	assert.Error(t, m.AddSetMembers(ctx, "value", 0, "a"))
+	require.NoError(t, m.AddSetMembers(ctx, "set", 0, "a"))
+	_, err = Get[string](ctx, m, "set")
+	assert.Error(t, err, "Sets cannot be read as values")
+}
+
+func TestMemoryCacheAsDefault(t *testing.T) {
+	withDefault(t, NewMemoryCache())
+	ctx := context.Background()
+	value := RedisTest{Name: "default", Value: "default-value"}
+
+	require.NoError(t, SetRedisData(ctx, "key", value, 1))
+	result, err := GetRedisData[RedisTest](ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, value, result)
+
+	require.NoError(t, UpdateRedisData(ctx, "key", RedisTest{Name: "updated"}))
+	require.NoError(t, DeleteRedisData(ctx, "key"))
+	assert.Error(t, DeleteRedisData(ctx, "key"))
+
+	n, err := IncrRedisData(ctx, "counter", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.NoError(t, FlushAllRedis(ctx))
+	exists, err := ExistsRedisData(ctx, "counter")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -2,152 +2,459 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	redis "github.com/redis/go-redis/v9"
 )
 
+// Options configures a Redis cache
+type Options struct {
+	// Addr is the host:port address of the Redis server
+	Addr     string
+	Username string
+	Password string
+	// DB is the database number, e.g. one for the sessions and another for the rate limits
+	DB int
+}
+
+// OptionsFromEnv reads the options from REDIS_HOST, REDIS_PORT, REDIS_USERNAME,
+// REDIS_PASSWORD and the optional REDIS_DB
+func OptionsFromEnv() (Options, error) {
+	host := os.Getenv("REDIS_HOST")
+	port := os.Getenv("REDIS_PORT")
+	if host == "" || port == "" {
+		return Options{}, fmt.Errorf("redis host or port not set")
+	}
+
+	opts := Options{
+		Addr:     fmt.Sprintf("%s:%s", host, port),
+		Username: os.Getenv("REDIS_USERNAME"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+	}
+	if db := os.Getenv("REDIS_DB"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil {
+			return Options{}, fmt.Errorf("invalid redis db %q", db)
+		}
+		opts.DB = n
+	}
+	return opts, nil
+}
+
+// RedisCache is a cache backed by a Redis database
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache connects to the Redis database of the options
+func NewRedisCache(opts Options) (*RedisCache, error) {
+	if opts.Addr == "" {
+		return nil, fmt.Errorf("redis address not set")
+	}
+	if opts.DB < 0 {
+		return nil, fmt.Errorf("invalid redis db %d", opts.DB)
+	}
+
+	c := newRedisCache(opts)
+
+	// Test the connection before handing out the cache
+	if err := c.client.Ping(context.Background()).Err(); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return c, nil
+}
+
+// newRedisCache returns a cache whose client connects on first use
+func newRedisCache(opts Options) *RedisCache {
+	return &RedisCache{client: redis.NewClient(&redis.Options{
+		Addr:     opts.Addr,
+		Username: opts.Username,
+		Password: opts.Password,
+		DB:       opts.DB,
+	})}
+}
+
+// Client returns the underlying Redis client
+func (c *RedisCache) Client() *redis.Client {
+	return c.client
+}
+
+// Get decodes the value stored at key into dest
+func (c *RedisCache) Get(ctx context.Context, key string, dest any) error {
+	res, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return notFound(key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get data from cache: %w", err)
+	}
+	return decode(res, dest)
+}
+
+// Take decodes the value stored at key into dest and deletes it atomically, so only one
+// caller gets a single-use value. It reports false when the key does not exist
+func (c *RedisCache) Take(ctx context.Context, key string, dest any) (bool, error) {
+	res, err := c.client.GetDel(ctx, key).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to take data from cache: %w", err)
+	}
+	return true, decode(res, dest)
+}
+
+// Set stores the value at key. 0 means no expiration
+func (c *RedisCache) Set(ctx context.Context, key string, value any, ttl time.Duration) error {
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set data in cache: %w", err)
+	}
+	return nil
+}
+
+// SetNX stores the value only if the key does not exist yet and reports whether it was stored.
+// 0 means no expiration
+func (c *RedisCache) SetNX(ctx context.Context, key string, value any, ttl time.Duration) (bool, error) {
+	data, err := encode(value)
+	if err != nil {
+		return false, err
+	}
+	ok, err := c.client.SetNX(ctx, key, data, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to set data in cache: %w", err)
+	}
+	return ok, nil
+}
+
+// Update replaces the value stored at key, preserving its TTL
+func (c *RedisCache) Update(ctx context.Context, key string, value any) error {
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+
+	// Update the key only if it exists, preserving its TTL. Checking the key and
+	// writing it in one command keeps a concurrent delete from being undone
+	err = c.client.SetArgs(ctx, key, data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return notFound(key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update data in cache: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the key
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	deleted, err := c.client.Del(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete data from cache: %w", err)
+	}
+	if deleted <= 0 {
+		return notFound(key)
+	}
+	return nil
+}
+
+// compareAndDelete deletes the key only if it holds the value
+var compareAndDelete = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// CompareAndDelete removes the key only if it holds the value, e.g. to release a lock
+// only when it is still owned. It reports whether the key was deleted
+func (c *RedisCache) CompareAndDelete(ctx context.Context, key string, value any) (bool, error) {
+	data, err := encode(value)
+	if err != nil {
+		return false, err
+	}
+	n, err := compareAndDelete.Run(ctx, c.client, []string{key}, data).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete data from cache: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Exists reports whether the key exists
+func (c *RedisCache) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check data in cache: %w", err)
+	}
+	return n > 0, nil
+}
+
+// TTL returns the remaining lifetime of the key, 0 when it does not expire
+func (c *RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.client.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expiration from cache: %w", err)
+	}
+	// Redis answers -2 when the key does not exist and -1 when it has no expiration
+	switch ttl {
+	case -2:
+		return 0, notFound(key)
+	case -1:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// incrExpire increments the counter and sets its expiration when it is created, in
+// milliseconds, so a counter never outlives its window for want of an expiration
+var incrExpire = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n`)
+
+// Incr increments the counter stored at key and returns its new value.
+// The expiration is set atomically when the counter is created. 0 means no expiration
+func (c *RedisCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	n, err := incrExpire.Run(ctx, c.client, []string{key}, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment data in cache: %w", err)
+	}
+	return n, nil
+}
+
+// AddSetMembers adds members to the set stored at key and resets its expiration. 0 means no expiration
+func (c *RedisCache) AddSetMembers(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	// Add the members and refresh the expiration atomically
+	pipe := c.client.TxPipeline()
+	pipe.SAdd(ctx, key, toArgs(members)...)
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add members to cache set: %w", err)
+	}
+	return nil
+}
+
+// SetMembers returns the members of the set stored at key, empty when the key does not exist
+func (c *RedisCache) SetMembers(ctx context.Context, key string) ([]string, error) {
+	members, err := c.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members from cache set: %w", err)
+	}
+	return members, nil
+}
+
+// RemoveSetMembers removes members from the set stored at key
+func (c *RedisCache) RemoveSetMembers(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	if err := c.client.SRem(ctx, key, toArgs(members)...).Err(); err != nil {
+		return fmt.Errorf("failed to remove members from cache set: %w", err)
+	}
+	return nil
+}
+
+// FlushAll removes all items from the server
+func (c *RedisCache) FlushAll(ctx context.Context) error {
+	if err := c.client.FlushAll(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to flush cache: %w", err)
+	}
+	return nil
+}
+
+// Close closes the Redis connection
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+func toArgs(members []string) []any {
+	values := make([]any, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return values
+}
+
 var (
-	// Client is the redis client instance
-	rdb            *redis.Client
 	onceRedisCache sync.Once
+	initRedisErr   error
 )
 
-// InitRedis initializes the redis client
+// InitRedis connects to the Redis server configured by the environment, see
+// OptionsFromEnv, and makes it the default cache of the package functions
 func InitRedis() error {
-	var initErr error
 	onceRedisCache.Do(func() {
-		host := os.Getenv("REDIS_HOST")
-		port := os.Getenv("REDIS_PORT")
-		password := os.Getenv("REDIS_PASSWORD")
-		username := os.Getenv("REDIS_USERNAME")
-
-		if host == "" || port == "" {
-			initErr = fmt.Errorf("redis host or port not set")
+		opts, err := OptionsFromEnv()
+		if err != nil {
+			initRedisErr = err
 			return
 		}
-
-		client := redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%s", host, port),
-			Password: password, // No need for fmt.Sprintf
-			DB:       0,
-			Username: username,
-		})
-
-		// Test Redis connection before assigning to rdb
-		if err := client.Ping(context.Background()).Err(); err != nil {
-			initErr = fmt.Errorf("failed to connect to Redis: %w", err)
+		c, err := NewRedisCache(opts)
+		if err != nil {
+			initRedisErr = err
 			return
 		}
-
-		// Assign the successfully connected client
-		rdb = client
+		SetDefault(c)
 	})
-
-	return initErr
+	return initRedisErr
 }
 
-// GetRedisData gets data from cache with JSON encoding
+// GetRedisData gets data from the default cache with JSON encoding
 func GetRedisData[T any](ctx context.Context, key string) (T, error) {
-	var zero T
-
-	// Get data from cache
-	res, err := rdb.Get(ctx, key).Result()
-	if err == redis.Nil {
-		return zero, fmt.Errorf("data not found in cache for key %s", key)
+	c, err := getDefault()
+	if err != nil {
+		var zero T
+		return zero, err
 	}
+	return Get[T](ctx, c, key)
+}
+
+// TakeRedisData gets and deletes data from the default cache atomically, so only one caller gets
+// a single-use value. found is false when the key does not exist
+func TakeRedisData[T any](ctx context.Context, key string) (value T, found bool, err error) {
+	var zero T
+	c, err := getDefaultAs[taker]()
 	if err != nil {
-		return zero, fmt.Errorf("failed to get data from cache: %w", err)
+		return zero, false, err
 	}
 
-	// Allocate memory for a pointer type
 	var result T
-	if err := json.Unmarshal([]byte(res), &result); err != nil {
-		return zero, fmt.Errorf("failed to unmarshal data from cache: %w", err)
+	found, err = c.Take(ctx, key, &result)
+	if err != nil || !found {
+		return zero, found, err
 	}
-	return result, nil
+	return result, true, nil
 }
 
-// SetRedisData sets data in cache with JSON encoding. 0 means no expiration. ttl is in seconds
+// SetRedisData sets data in the default cache with JSON encoding. 0 means no expiration. ttl is in minutes
 func SetRedisData(ctx context.Context, key string, value any, ttl int32) error {
-	// Convert value to JSON
-	jsonData, err := json.Marshal(value)
+	return SetRedisDataTTL(ctx, key, value, time.Duration(ttl)*time.Minute)
+}
+
+// SetRedisDataTTL sets data in the default cache with JSON encoding and an exact expiration. 0 means no expiration
+func SetRedisDataTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	c, err := getDefault()
 	if err != nil {
-		return fmt.Errorf("failed to marshal data: %w", err)
+		return err
 	}
+	return c.Set(ctx, key, value, ttl)
+}
 
-	// Set data in cache
-	err = rdb.Set(ctx, key, jsonData, time.Duration(ttl)*time.Minute).Err()
+// SetRedisDataNX sets data in the default cache only if the key does not exist yet.
+// It reports whether the value was stored. 0 means no expiration
+func SetRedisDataNX(ctx context.Context, key string, value any, ttl time.Duration) (bool, error) {
+	c, err := getDefaultAs[nxSetter]()
 	if err != nil {
-		return fmt.Errorf("failed to set data in cache: %w", err)
+		return false, err
 	}
-	return nil
+	return c.SetNX(ctx, key, value, ttl)
 }
 
-// UpdateRedisData updates data in cache. 0 means no expiration. ttl is in seconds
-func UpdateRedisData(ctx context.Context, key string, newValue interface{}) error {
-	// Check if the key exists
-	ttl, err := rdb.TTL(ctx, key).Result()
+// ExistsRedisData reports whether the key exists in the default cache
+func ExistsRedisData(ctx context.Context, key string) (bool, error) {
+	c, err := getDefault()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve TTL for key %s: %w", key, err)
+		return false, err
 	}
+	return c.Exists(ctx, key)
+}
 
-	// If TTL is -1, the key does not exist
-	if ttl == -1 {
-		return fmt.Errorf("data not found in cache for key %s", key)
+// IncrRedisData increments the counter stored at key and returns its new value.
+// The expiration is set when the counter is created. 0 means no expiration
+func IncrRedisData(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	c, err := getDefaultAs[counter]()
+	if err != nil {
+		return 0, err
 	}
+	return c.Incr(ctx, key, ttl)
+}
 
-	// Serialize new value to JSON
-	data, err := json.Marshal(newValue)
+// AddRedisSetMembers adds members to the set stored at key and resets its expiration. 0 means no expiration
+func AddRedisSetMembers(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	c, err := getDefaultAs[setStore]()
 	if err != nil {
-		return fmt.Errorf("failed to marshal new data: %w", err)
+		return err
 	}
+	return c.AddSetMembers(ctx, key, ttl, members...)
+}
 
-	// Update the key, preserving its TTL
-	err = rdb.Set(ctx, key, data, ttl).Err()
+// GetRedisSetMembers returns the members of the set stored at key, empty when the key does not exist
+func GetRedisSetMembers(ctx context.Context, key string) ([]string, error) {
+	c, err := getDefaultAs[setStore]()
 	if err != nil {
-		return fmt.Errorf("failed to update data in cache: %w", err)
+		return nil, err
 	}
-
-	return nil
+	return c.SetMembers(ctx, key)
 }
 
-// DeleteRedisData deletes data from cache
-func DeleteRedisData(ctx context.Context, key string) error {
-	// Attempt to delete the key
-	deleted, err := rdb.Del(ctx, key).Result()
+// RemoveRedisSetMembers removes members from the set stored at key
+func RemoveRedisSetMembers(ctx context.Context, key string, members ...string) error {
+	c, err := getDefaultAs[setStore]()
 	if err != nil {
-		return fmt.Errorf("failed to delete data from cache: %w", err)
+		return err
 	}
+	return c.RemoveSetMembers(ctx, key, members...)
+}
 
-	// Check if the key existed
-	if deleted <= 0 {
-		return fmt.Errorf("data not found in cache for key %s", key)
+// UpdateRedisData updates data in the default cache, preserving its TTL. It fails if the key does not exist
+func UpdateRedisData(ctx context.Context, key string, newValue interface{}) error {
+	c, err := getDefault()
+	if err != nil {
+		return err
 	}
+	return c.Update(ctx, key, newValue)
+}
 
-	return nil
+// DeleteRedisData deletes data from the default cache
+func DeleteRedisData(ctx context.Context, key string) error {
+	c, err := getDefault()
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, key)
 }
 
-// FlushAll removes all items from cache
+// FlushAllRedis removes all items from the default cache
 func FlushAllRedis(ctx context.Context) error {
-	if err := rdb.FlushAll(ctx).Err(); err != nil {
-		return fmt.Errorf("failed to flush cache: %w", err)
+	c, err := getDefaultAs[flusher]()
+	if err != nil {
+		return err
 	}
-	return nil
+	return c.FlushAll(ctx)
 }
 
-// CloseRedis closes the Redis connection
+// CloseRedis closes the connection of the default cache
 func CloseRedis() error {
-	if rdb != nil {
-		return rdb.Close()
+	if c, ok := Default().(io.Closer); ok {
+		return c.Close()
 	}
 	return nil
 }
 
+// ExportRedisClient returns the client of the default cache, nil when it is not backed by Redis
 func ExportRedisClient() *redis.Client {
-	return rdb
+	c := Default()
+	if f, ok := c.(*FallbackCache); ok {
+		c = f.primary
+	}
+	if r, ok := c.(*RedisCache); ok {
+		return r.client
+	}
+	return nil
 }
@@ -4,14 +4,20 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func setupTestRedis() {
+// setupTestRedis sets the default cache to the local Redis, skipping the test when it is not running
+func setupTestRedis(t *testing.T) {
+	t.Helper()
 	_ = os.Setenv("REDIS_HOST", "localhost")
 	_ = os.Setenv("REDIS_PORT", "6379")
-	_ = InitRedis()
+	if err := InitRedis(); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
 }
 
 type RedisTest struct {
@@ -20,15 +26,16 @@ type RedisTest struct {
 }
 
 func TestInitRedis(t *testing.T) {
-	setupTestRedis()
+	setupTestRedis(t)
 
-	assert.NotNil(t, rdb, "Redis client should be initialized")
-	err := rdb.Ping(context.Background()).Err()
+	client := ExportRedisClient()
+	require.NotNil(t, client, "Redis client should be initialized")
+	err := client.Ping(context.Background()).Err()
 	assert.NoError(t, err, "Redis should be accessible")
 }
 
 func TestSetGetRedisData(t *testing.T) {
-	setupTestRedis()
+	setupTestRedis(t)
 	ctx := context.Background()
 	key := "test-key"
 	value := RedisTest{Name: "test", Value: "test-value"}
@@ -42,8 +49,117 @@ func TestSetGetRedisData(t *testing.T) {
 	assert.Equal(t, value, result, "Stored and retrieved values should match")
 }
 
+func TestTakeRedisData(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	key := "test-key-take"
+	value := RedisTest{Name: "take", Value: "take-value"}
+
+	err := SetRedisDataTTL(ctx, key, value, time.Minute)
+	assert.NoError(t, err)
+
+	result, found, err := TakeRedisData[RedisTest](ctx, key)
+	assert.NoError(t, err, "TakeRedisData should not return an error")
+	assert.True(t, found)
+	assert.Equal(t, value, result)
+
+	_, found, err = TakeRedisData[RedisTest](ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, found, "A value can only be taken once")
+}
+
+func TestSetRedisDataTTL(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	key := "test-key-ttl"
+	value := RedisTest{Name: "ttl", Value: "ttl-value"}
+
+	err := SetRedisDataTTL(ctx, key, value, 30*time.Second)
+	assert.NoError(t, err, "SetRedisDataTTL should not return an error")
+
+	ttl, err := ExportRedisClient().TTL(ctx, key).Result()
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, ttl, 30*time.Second, "TTL should not exceed the given duration")
+	assert.Greater(t, ttl, time.Duration(0), "TTL should be set")
+}
+
+func TestSetRedisDataNX(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	key := "test-key-nx"
+	_ = DeleteRedisData(ctx, key)
+
+	ok, err := SetRedisDataNX(ctx, key, "first", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "First SetRedisDataNX should store the value")
+
+	ok, err = SetRedisDataNX(ctx, key, "second", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok, "Second SetRedisDataNX should not override the value")
+
+	result, err := GetRedisData[string](ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", result)
+}
+
+func TestExistsRedisData(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	key := "test-key-exists"
+
+	_ = SetRedisData(ctx, key, "value", 1)
+	exists, err := ExistsRedisData(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, exists, "Key should exist")
+
+	_ = DeleteRedisData(ctx, key)
+	exists, err = ExistsRedisData(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, exists, "Deleted key should not exist")
+}
+
+func TestIncrRedisData(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	key := "test-key-incr"
+	_ = DeleteRedisData(ctx, key)
+
+	n, err := IncrRedisData(ctx, key, time.Minute)
+	assert.NoError(t, err, "IncrRedisData should not return an error")
+	assert.Equal(t, int64(1), n)
+
+	n, err = IncrRedisData(ctx, key, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	ttl, err := ExportRedisClient().TTL(ctx, key).Result()
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0), "TTL should be set on creation")
+}
+
+func TestRedisSetMembers(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	key := "test-key-set"
+	_ = DeleteRedisData(ctx, key)
+
+	err := AddRedisSetMembers(ctx, key, time.Minute, "a", "b")
+	assert.NoError(t, err, "AddRedisSetMembers should not return an error")
+
+	members, err := GetRedisSetMembers(ctx, key)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, members)
+
+	err = RemoveRedisSetMembers(ctx, key, "a")
+	assert.NoError(t, err, "RemoveRedisSetMembers should not return an error")
+
+	members, err = GetRedisSetMembers(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, members)
+}
+
 func TestUpdateRedisData(t *testing.T) {
-	setupTestRedis()
+	setupTestRedis(t)
 	ctx := context.Background()
 	key := "test-key"
 	initialValue := RedisTest{Name: "initial", Value: "initial"}
@@ -61,7 +177,7 @@ func TestUpdateRedisData(t *testing.T) {
 }
 
 func TestDeleteRedisData(t *testing.T) {
-	setupTestRedis()
+	setupTestRedis(t)
 	ctx := context.Background()
 	key := "test-key"
 
@@ -75,7 +191,7 @@ func TestDeleteRedisData(t *testing.T) {
 }
 
 func TestFlushAllRedis(t *testing.T) {
-	setupTestRedis()
+	setupTestRedis(t)
 	ctx := context.Background()
 
 	_ = SetRedisData(ctx, "key1", "value1", 1)
@@ -92,7 +208,74 @@ func TestFlushAllRedis(t *testing.T) {
 }
 
 func TestCloseRedis(t *testing.T) {
-	setupTestRedis()
+	setupTestRedis(t)
 	err := CloseRedis()
 	assert.NoError(t, err, "CloseRedis should not return an error")
 }
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("REDIS_HOST", "redis.internal")
+	t.Setenv("REDIS_PORT", "6380")
+	t.Setenv("REDIS_USERNAME", "feeti")
+	t.Setenv("REDIS_PASSWORD", "secret")
+	t.Setenv("REDIS_DB", "2")
+
+	opts, err := OptionsFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, Options{Addr: "redis.internal:6380", Username: "feeti", Password: "secret", DB: 2}, opts)
+
+	t.Setenv("REDIS_DB", "sessions")
+	_, err = OptionsFromEnv()
+	assert.Error(t, err, "REDIS_DB should be a number")
+
+	t.Setenv("REDIS_PORT", "")
+	_, err = OptionsFromEnv()
+	assert.Error(t, err, "REDIS_PORT is required")
+}
+
+func TestNewRedisCacheInvalidOptions(t *testing.T) {
+	_, err := NewRedisCache(Options{})
+	assert.Error(t, err, "The address is required")
+
+	_, err = NewRedisCache(Options{Addr: "localhost:6379", DB: -1})
+	assert.Error(t, err, "The database number cannot be negative")
+}
+
+func TestRedisCacheInstances(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	sessions, err := NewRedisCache(Options{Addr: "localhost:6379", DB: 1})
+	require.NoError(t, err)
+	defer sessions.Close()
+	rateLimits, err := NewRedisCache(Options{Addr: "localhost:6379", DB: 2})
+	require.NoError(t, err)
+	defer rateLimits.Close()
+
+	key := "test-key-instances"
+	value := RedisTest{Name: "session", Value: "session-value"}
+	require.NoError(t, sessions.Set(ctx, key, value, time.Minute))
+	_ = rateLimits.Delete(ctx, key)
+
+	result, err := Get[RedisTest](ctx, sessions, key)
+	assert.NoError(t, err)
+	assert.Equal(t, value, result)
+
+	_, err = Get[RedisTest](ctx, rateLimits, key)
+	assert.ErrorIs(t, err, ErrNotFound, "Instances on other databases should not share keys")
+
+	ttl, err := sessions.TTL(ctx, key)
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+	assert.LessOrEqual(t, ttl, time.Minute)
+
+	require.NoError(t, sessions.Set(ctx, key, value, 0))
+	ttl, err = sessions.TTL(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ttl, "Keys without expiration have no TTL")
+
+	require.NoError(t, sessions.Delete(ctx, key))
+	_, err = sessions.TTL(ctx, key)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, sessions.Update(ctx, key, value), ErrNotFound)
+	assert.ErrorIs(t, sessions.Delete(ctx, key), ErrNotFound)
+}
@@ -1,32 +1,47 @@
 package middleware
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 )
 
+// securityHeaders are the headers set by Helmet and HelmetHandler
+var securityHeaders = [][2]string{
+	{"X-Frame-Options", "SAMEORIGIN"},
+	{"X-Content-Type-Options", "nosniff"},
+	{"X-XSS-Protection", "1; mode=block"},
+	{"Referrer-Policy", "strict-origin-when-cross-origin"},
+	{"Content-Security-Policy", "default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self' data:; font-src 'self'; connect-src 'self';"},
+	{"Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload"},
+	{"Permissions-Policy", "geolocation=(), microphone=(), camera=()"},
+}
+
 // Helmet is a middleware function that sets various security headers.
 func Helmet() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Helper to set header only if not already set
-		setHeaderIfNotExist := func(key, value string) {
-			if c.Writer.Header().Get(key) == "" {
-				c.Header(key, value)
-			}
-		}
-
-		// Set security headers if they don't already exist
-		setHeaderIfNotExist("X-Frame-Options", "SAMEORIGIN")
-		setHeaderIfNotExist("X-Content-Type-Options", "nosniff")
-		setHeaderIfNotExist("X-XSS-Protection", "1; mode=block")
-		setHeaderIfNotExist("Referrer-Policy", "strict-origin-when-cross-origin")
-		setHeaderIfNotExist("Content-Security-Policy", "default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self' data:; font-src 'self'; connect-src 'self';")
-		setHeaderIfNotExist("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
-		setHeaderIfNotExist("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
+		setSecurityHeaders(c.Writer.Header())
+		c.Next()
+	}
+}
 
-		// Always remove these headers by setting them to empty
-		c.Header("X-Powered-By", "")
-		c.Header("Server", "")
+// HelmetHandler is the net/http equivalent of Helmet.
+func HelmetHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setSecurityHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
 
-		c.Next()
+// setSecurityHeaders sets the security headers that are not already set
+func setSecurityHeaders(header http.Header) {
+	for _, h := range securityHeaders {
+		if header.Get(h[0]) == "" {
+			header.Set(h[0], h[1])
+		}
 	}
+
+	// Always remove these headers
+	header.Del("X-Powered-By")
+	header.Del("Server")
 }
@@ -142,3 +142,21 @@ func TestHelmetAllHeaders(t *testing.T) {
 		assert.Empty(t, w.Header().Get("Server"))
 	})
 }
+
+func TestHelmetHandler(t *testing.T) {
+	handler := HelmetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Server", "nginx")
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"), "existing headers are preserved")
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "max-age=63072000; includeSubDomains; preload", w.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, w.Header().Get("Server"))
+}
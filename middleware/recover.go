@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,21 +12,21 @@ import (
 
 var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
+// internalServerError is the body sent when a handler panics
+var internalServerError = map[string]any{
+	"success": false,
+	"message": "Internal server error",
+}
+
 // Recover recovers from panics and returns a 500 Internal Server Error response.
 func Recover() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				message := fmt.Sprintf("%v", err)
-				logger.Error(message)
+				logPanic(err)
 				// Try to write header only if not already written
 				if !c.Writer.Written() {
-					c.AbortWithStatusJSON(
-						http.StatusInternalServerError, gin.H{
-							"success": false,
-							"message": "Internal server error",
-						},
-					)
+					c.AbortWithStatusJSON(http.StatusInternalServerError, internalServerError)
 				} else {
 					c.AbortWithStatus(http.StatusInternalServerError)
 				}
@@ -34,3 +35,52 @@ func Recover() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RecoverHandler is the net/http equivalent of Recover.
+func RecoverHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					// Let net/http abort the response silently
+					panic(err)
+				}
+				logPanic(err)
+				// The response cannot be changed once the header is written
+				if !rw.written {
+					w.Header().Set("Content-Type", "application/json; charset=utf-8")
+					w.WriteHeader(http.StatusInternalServerError)
+					_ = json.NewEncoder(w).Encode(internalServerError)
+				}
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// logPanic logs the value recovered from a panic
+func logPanic(err any) {
+	logger.Error(fmt.Sprintf("%v", err))
+}
+
+// responseWriter records whether the header has been written
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -28,3 +28,30 @@ func TestRecoveryMiddleware(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Contains(t, w.Body.String(), "Internal server error")
 }
+
+func TestRecoverHandler(t *testing.T) {
+	handler := middleware.RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("Something broke!")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"message":"Internal server error","success":false}`, w.Body.String())
+}
+
+func TestRecoverHandlerAfterWrite(t *testing.T) {
+	handler := middleware.RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("Something broke!")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code, "the written status is kept")
+	assert.Empty(t, w.Body.String())
+}
@@ -0,0 +1,140 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultDigits is the number of digits of the codes when none is given
+	DefaultDigits = 6
+	// DefaultPeriod is the time step of TOTP codes when none is given
+	DefaultPeriod = 30 * time.Second
+)
+
+// powers of ten used to truncate the codes
+var digitsModulo = [...]uint32{1, 10, 100, 1000, 10000, 100000, 1000000, 10000000, 100000000, 1000000000}
+
+// HOTP returns the counter based code of RFC 4226 for the secret
+func HOTP(secret []byte, counter uint64, digits int) string {
+	digits = validDigits(digits)
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, value%digitsModulo[digits])
+}
+
+// TOTP returns the time based code of RFC 6238 for the secret at the given time
+func TOTP(secret []byte, t time.Time, period time.Duration, digits int) string {
+	return HOTP(secret, totpCounter(t, period), digits)
+}
+
+// VerifyTOTP checks a time based code, accepting codes of up to skew periods
+// before or after t to tolerate clock drift of the device. A code stays valid for
+// its whole window, use VerifyTOTPAfter to refuse replays
+func VerifyTOTP(secret []byte, code string, t time.Time, period time.Duration, digits int, skew int) bool {
+	_, ok := verifyTOTP(secret, code, t, period, digits, skew, 0)
+	return ok
+}
+
+// VerifyTOTPAfter works like VerifyTOTP but only accepts the codes of a step after last,
+// the step of the previously accepted code, so a code cannot be used twice. It returns
+// the step of the code, to be stored as the new last one
+func VerifyTOTPAfter(secret []byte, code string, t time.Time, period time.Duration, digits int, skew int, last uint64) (uint64, bool) {
+	return verifyTOTP(secret, code, t, period, digits, skew, last+1)
+}
+
+// verifyTOTP returns the step of the code, skipping the steps before from
+func verifyTOTP(secret []byte, code string, t time.Time, period time.Duration, digits int, skew int, from uint64) (uint64, bool) {
+	if len(code) != validDigits(digits) {
+		return 0, false
+	}
+	counter := totpCounter(t, period)
+	valid, matched := 0, uint64(0)
+	for i := -skew; i <= skew; i++ {
+		if i < 0 && counter < uint64(-i) {
+			continue
+		}
+		step := counter + uint64(i)
+		if step < from {
+			continue
+		}
+		expected := HOTP(secret, step, digits)
+		// Check every step to keep the comparison time constant
+		match := subtle.ConstantTimeCompare([]byte(expected), []byte(code))
+		matched = uint64(subtle.ConstantTimeSelect(match, int(step), int(matched)))
+		valid |= match
+	}
+	return matched, valid == 1
+}
+
+// GenerateSecret returns a random secret of 20 bytes, the size recommended by RFC 4226
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns the base32 form of the secret typed in authenticator apps
+func EncodeSecret(secret []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
+
+// ProvisioningURI returns the otpauth:// URI to render as a QR code for authenticator apps
+func ProvisioningURI(issuer, account string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("digits", strconv.Itoa(DefaultDigits))
+	query.Set("period", strconv.Itoa(int(DefaultPeriod.Seconds())))
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// randomCode returns a uniformly distributed random numeric code, e.g. for SMS
+func randomCode(digits int) (string, error) {
+	digits = validDigits(digits)
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(digitsModulo[digits])))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", digits, n.Int64()), nil
+}
+
+func totpCounter(t time.Time, period time.Duration) uint64 {
+	if period <= 0 {
+		period = DefaultPeriod
+	}
+	// Steps are whole seconds, shorter periods are rounded up to one second
+	seconds := int64((period + time.Second - 1) / time.Second)
+	return uint64(t.Unix() / seconds)
+}
+
+func validDigits(digits int) int {
+	if digits < 6 || digits >= len(digitsModulo) {
+		return DefaultDigits
+	}
+	return digits
+}
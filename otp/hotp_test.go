@@ -0,0 +1,83 @@
+package otp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test secret of RFC 4226 and RFC 6238
+var rfcSecret = []byte("12345678901234567890")
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 Appendix D
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range expected {
+		assert.Equal(t, code, HOTP(rfcSecret, uint64(counter), 6))
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 Appendix B, SHA1
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, TOTP(rfcSecret, time.Unix(tt.unix, 0), 30*time.Second, 8))
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := TOTP(rfcSecret, now, DefaultPeriod, 6)
+
+	assert.True(t, VerifyTOTP(rfcSecret, code, now, DefaultPeriod, 6, 1))
+	assert.True(t, VerifyTOTP(rfcSecret, code, now.Add(30*time.Second), DefaultPeriod, 6, 1), "drift of one step")
+	assert.False(t, VerifyTOTP(rfcSecret, code, now.Add(90*time.Second), DefaultPeriod, 6, 1))
+	assert.False(t, VerifyTOTP(rfcSecret, "000000", now, DefaultPeriod, 6, 1))
+	assert.False(t, VerifyTOTP(rfcSecret, code[:5], now, DefaultPeriod, 6, 1))
+}
+
+func TestVerifyTOTPAfter(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := TOTP(rfcSecret, now, DefaultPeriod, 6)
+
+	step, ok := VerifyTOTPAfter(rfcSecret, code, now, DefaultPeriod, 6, 1, 0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1234567890/30), step)
+
+	_, ok = VerifyTOTPAfter(rfcSecret, code, now.Add(10*time.Second), DefaultPeriod, 6, 1, step)
+	assert.False(t, ok, "a code cannot be replayed")
+
+	next := TOTP(rfcSecret, now.Add(30*time.Second), DefaultPeriod, 6)
+	nextStep, ok := VerifyTOTPAfter(rfcSecret, next, now.Add(30*time.Second), DefaultPeriod, 6, 1, step)
+	assert.True(t, ok)
+	assert.Equal(t, step+1, nextStep)
+}
+
+func TestTOTPShortPeriod(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	assert.NotPanics(t, func() {
+		assert.Equal(t, TOTP(rfcSecret, now, time.Second, 6), TOTP(rfcSecret, now, 500*time.Millisecond, 6))
+	}, "periods under a second are rounded up")
+}
+
+func TestProvisioningURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 20)
+
+	uri := ProvisioningURI("Feeti", "+2250700000000", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Feeti:"))
+	assert.Contains(t, uri, "secret="+EncodeSecret(secret))
+}
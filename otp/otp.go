@@ -0,0 +1,192 @@
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Purpose scopes a code to an operation, a login code cannot be used to withdraw
+type Purpose string
+
+const (
+	// PurposeLogin confirms a login from a new device
+	PurposeLogin Purpose = "login"
+	// PurposeWithdraw confirms a withdrawal
+	PurposeWithdraw Purpose = "withdraw"
+	// PurposePINReset confirms a PIN reset
+	PurposePINReset Purpose = "pin_reset"
+)
+
+const (
+	// DefaultTTL is the lifetime of a code when none is given
+	DefaultTTL = 5 * time.Minute
+	// DefaultMaxAttempts is the number of checks allowed per code when none is given
+	DefaultMaxAttempts = 5
+	// DefaultResendCooldown is the delay between two codes for the same purpose and recipient when none is given
+	DefaultResendCooldown = time.Minute
+)
+
+var (
+	// ErrCodeNotFound is returned when no code is pending, it expired or was already used
+	ErrCodeNotFound = errors.New("otp code not found")
+	// ErrCodeExpired is returned when the code is past its lifetime
+	ErrCodeExpired = errors.New("otp code expired")
+	// ErrInvalidCode is returned when the code does not match
+	ErrInvalidCode = errors.New("invalid otp code")
+	// ErrTooManyAttempts is returned when the code was checked too many times. The code is discarded
+	ErrTooManyAttempts = errors.New("too many otp attempts")
+	// ErrResendCooldown is returned when a new code is requested too soon
+	ErrResendCooldown = errors.New("otp resend cooldown")
+)
+
+// Config configures a Manager
+type Config struct {
+	// Secret peppers the hashes of the codes. It is required
+	Secret []byte
+	// Digits is the length of the codes. It defaults to DefaultDigits
+	Digits int
+	// TTL is the lifetime of the codes. It defaults to DefaultTTL
+	TTL time.Duration
+	// MaxAttempts is the number of checks allowed per code. It defaults to DefaultMaxAttempts
+	MaxAttempts int
+	// ResendCooldown is the delay between two codes. It defaults to DefaultResendCooldown
+	ResendCooldown time.Duration
+	// Now returns the current time. It defaults to time.Now and is meant to be replaced in tests
+	Now func() time.Time
+}
+
+// Manager creates and checks one-time codes sent by SMS, e.g. in the otp.create and otp.check handlers
+type Manager struct {
+	store Store
+	cfg   Config
+}
+
+// NewManager creates an OTP manager storing the hashed codes in store
+func NewManager(store Store, cfg Config) (*Manager, error) {
+	if store == nil {
+		return nil, fmt.Errorf("otp store not set")
+	}
+	if len(cfg.Secret) == 0 {
+		return nil, fmt.Errorf("otp secret not set")
+	}
+	cfg.Digits = validDigits(cfg.Digits)
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.ResendCooldown <= 0 {
+		cfg.ResendCooldown = DefaultResendCooldown
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Manager{store: store, cfg: cfg}, nil
+}
+
+// Create generates a code for the purpose and recipient, e.g. a phone number, and
+// returns it to be sent. Only its hash is stored and it replaces any pending code
+func (m *Manager) Create(ctx context.Context, purpose Purpose, recipient string) (string, error) {
+	if purpose == "" || recipient == "" {
+		return "", fmt.Errorf("invalid otp purpose or recipient")
+	}
+	key := recordKey(purpose, recipient)
+	now := m.cfg.Now()
+
+	// Enforce the resend cooldown
+	record, err := m.store.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrCodeNotFound) {
+		return "", err
+	}
+	if err == nil && now.Before(record.CreatedAt.Add(m.cfg.ResendCooldown)) {
+		return "", ErrResendCooldown
+	}
+
+	code, err := randomCode(m.cfg.Digits)
+	if err != nil {
+		return "", err
+	}
+	record = Record{
+		Hash:      m.hash(purpose, recipient, code),
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.cfg.TTL),
+	}
+	// Keep the record for the cooldown even when the code expires sooner
+	if err := m.store.Save(ctx, key, record, max(m.cfg.TTL, m.cfg.ResendCooldown)); err != nil {
+		return "", fmt.Errorf("failed to save otp code: %w", err)
+	}
+	return code, nil
+}
+
+// Check verifies the code for the purpose and recipient. A valid code can only be used once
+func (m *Manager) Check(ctx context.Context, purpose Purpose, recipient, code string) error {
+	key := recordKey(purpose, recipient)
+	record, err := m.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if record.Exhausted {
+		return ErrCodeNotFound
+	}
+	if m.cfg.Now().After(record.ExpiresAt) {
+		return ErrCodeExpired
+	}
+
+	// Count the attempt before comparing so concurrent guesses are counted too
+	attempts, err := m.store.IncrementAttempts(ctx, key, m.cfg.TTL)
+	if err != nil {
+		return fmt.Errorf("failed to count otp attempt: %w", err)
+	}
+	if attempts > m.cfg.MaxAttempts {
+		return m.discard(ctx, key, record)
+	}
+
+	if !hmac.Equal([]byte(record.Hash), []byte(m.hash(purpose, recipient, code))) {
+		if attempts == m.cfg.MaxAttempts {
+			return m.discard(ctx, key, record)
+		}
+		return ErrInvalidCode
+	}
+
+	// Only the check that deletes the code succeeds
+	if err := m.store.Delete(ctx, key); err != nil {
+		return err
+	}
+	return nil
+}
+
+// discard marks the pending code exhausted and returns ErrTooManyAttempts. The record is
+// kept until the resend cooldown ends, Create reading it to refuse a new code meanwhile
+func (m *Manager) discard(ctx context.Context, key string, record Record) error {
+	ttl := record.CreatedAt.Add(max(m.cfg.TTL, m.cfg.ResendCooldown)).Sub(m.cfg.Now())
+	if ttl <= 0 {
+		if err := m.store.Delete(ctx, key); err != nil && !errors.Is(err, ErrCodeNotFound) {
+			return fmt.Errorf("failed to delete otp code: %w", err)
+		}
+		return ErrTooManyAttempts
+	}
+
+	record.Hash = ""
+	record.Exhausted = true
+	if err := m.store.Save(ctx, key, record, ttl); err != nil {
+		return fmt.Errorf("failed to discard otp code: %w", err)
+	}
+	return ErrTooManyAttempts
+}
+
+// hash binds the code to its purpose and recipient
+func (m *Manager) hash(purpose Purpose, recipient, code string) string {
+	mac := hmac.New(sha256.New, m.cfg.Secret)
+	mac.Write([]byte(string(purpose) + "|" + recipient + "|" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func recordKey(purpose Purpose, recipient string) string {
+	return fmt.Sprintf("%s:%s", purpose, recipient)
+}
@@ -0,0 +1,139 @@
+package otp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const phone = "+2250700000000"
+
+// testClock is a clock moved by hand
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestManager(t *testing.T) (*Manager, *MemoryStore, *testClock) {
+	clock := &testClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	manager, err := NewManager(store, Config{
+		Secret:         []byte("otp_secret"),
+		MaxAttempts:    3,
+		TTL:            5 * time.Minute,
+		ResendCooldown: time.Minute,
+		Now:            clock.Now,
+	})
+	require.NoError(t, err)
+	return manager, store, clock
+}
+
+func TestManagerCreateCheck(t *testing.T) {
+	ctx := context.Background()
+	manager, store, _ := newTestManager(t)
+
+	code, err := manager.Create(ctx, PurposeLogin, phone)
+	require.NoError(t, err)
+	assert.Len(t, code, DefaultDigits)
+
+	record, err := store.Get(ctx, recordKey(PurposeLogin, phone))
+	require.NoError(t, err)
+	assert.NotContains(t, record.Hash, code, "only the hash is stored")
+
+	assert.ErrorIs(t, manager.Check(ctx, PurposeWithdraw, phone, code), ErrCodeNotFound, "codes are scoped to their purpose")
+	assert.NoError(t, manager.Check(ctx, PurposeLogin, phone, code))
+	assert.ErrorIs(t, manager.Check(ctx, PurposeLogin, phone, code), ErrCodeNotFound, "codes are single use")
+}
+
+func TestManagerExpiry(t *testing.T) {
+	ctx := context.Background()
+	manager, _, clock := newTestManager(t)
+
+	code, err := manager.Create(ctx, PurposeWithdraw, phone)
+	require.NoError(t, err)
+
+	clock.Advance(5*time.Minute + time.Second)
+	assert.ErrorIs(t, manager.Check(ctx, PurposeWithdraw, phone, code), ErrCodeExpired)
+}
+
+func TestManagerMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	manager, _, _ := newTestManager(t)
+
+	code, err := manager.Create(ctx, PurposePINReset, phone)
+	require.NoError(t, err)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	assert.ErrorIs(t, manager.Check(ctx, PurposePINReset, phone, wrong), ErrInvalidCode)
+	assert.ErrorIs(t, manager.Check(ctx, PurposePINReset, phone, wrong), ErrInvalidCode)
+	assert.ErrorIs(t, manager.Check(ctx, PurposePINReset, phone, wrong), ErrTooManyAttempts)
+	assert.ErrorIs(t, manager.Check(ctx, PurposePINReset, phone, code), ErrCodeNotFound, "the code is discarded")
+}
+
+func TestManagerResendCooldown(t *testing.T) {
+	ctx := context.Background()
+	manager, _, clock := newTestManager(t)
+
+	first, err := manager.Create(ctx, PurposeLogin, phone)
+	require.NoError(t, err)
+
+	_, err = manager.Create(ctx, PurposeLogin, phone)
+	assert.ErrorIs(t, err, ErrResendCooldown)
+
+	// Other purposes are not affected
+	_, err = manager.Create(ctx, PurposeWithdraw, phone)
+	assert.NoError(t, err)
+
+	clock.Advance(time.Minute)
+	second, err := manager.Create(ctx, PurposeLogin, phone)
+	require.NoError(t, err)
+
+	if first != second {
+		assert.ErrorIs(t, manager.Check(ctx, PurposeLogin, phone, first), ErrInvalidCode, "a new code replaces the pending one")
+	}
+	assert.NoError(t, manager.Check(ctx, PurposeLogin, phone, second))
+}
+
+func TestNewManagerRequiresSecret(t *testing.T) {
+	_, err := NewManager(NewMemoryStore(), Config{})
+	assert.Error(t, err)
+}
+
+func TestManagerMaxAttemptsKeepsCooldown(t *testing.T) {
+	ctx := context.Background()
+	manager, _, clock := newTestManager(t)
+
+	code, err := manager.Create(ctx, PurposeLogin, phone)
+	require.NoError(t, err)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for range 2 {
+		assert.ErrorIs(t, manager.Check(ctx, PurposeLogin, phone, wrong), ErrInvalidCode)
+	}
+	assert.ErrorIs(t, manager.Check(ctx, PurposeLogin, phone, wrong), ErrTooManyAttempts)
+
+	// Exhausting the attempts does not grant a new code with fresh attempts
+	_, err = manager.Create(ctx, PurposeLogin, phone)
+	assert.ErrorIs(t, err, ErrResendCooldown)
+	assert.ErrorIs(t, manager.Check(ctx, PurposeLogin, phone, code), ErrCodeNotFound)
+
+	clock.Advance(time.Minute)
+	code, err = manager.Create(ctx, PurposeLogin, phone)
+	require.NoError(t, err)
+	assert.NoError(t, manager.Check(ctx, PurposeLogin, phone, code))
+}
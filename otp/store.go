@@ -0,0 +1,153 @@
+package otp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emmadal/feeti-module/cache"
+)
+
+// Record is the stored state of a pending code
+type Record struct {
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Exhausted marks a code discarded after too many attempts. The record is kept
+	// until the resend cooldown ends so a new code cannot be requested right away
+	Exhausted bool `json:"exhausted,omitempty"`
+}
+
+// Store persists pending codes and their attempts
+type Store interface {
+	// Save stores the record under key until ttl elapses and resets its attempts
+	Save(ctx context.Context, key string, record Record, ttl time.Duration) error
+	// Get returns the record stored under key, ErrCodeNotFound when there is none
+	Get(ctx context.Context, key string) (Record, error)
+	// IncrementAttempts counts a check of the record and returns the number of checks
+	IncrementAttempts(ctx context.Context, key string, ttl time.Duration) (int, error)
+	// Delete removes the record and its attempts
+	Delete(ctx context.Context, key string) error
+}
+
+// RedisStore stores the codes in Redis through the cache package
+type RedisStore struct{}
+
+// NewRedisStore returns a store backed by Redis. cache.InitRedis must be called first
+func NewRedisStore() *RedisStore {
+	return &RedisStore{}
+}
+
+func otpKey(key string) string {
+	return fmt.Sprintf("otp:%s", key)
+}
+
+func otpAttemptsKey(key string) string {
+	return fmt.Sprintf("otp_attempts:%s", key)
+}
+
+// Save stores the record under key until ttl elapses and resets its attempts
+func (s *RedisStore) Save(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	if err := s.deleteAttempts(ctx, key); err != nil {
+		return err
+	}
+	return cache.SetRedisDataTTL(ctx, otpKey(key), record, ttl)
+}
+
+// Get returns the record stored under key, ErrCodeNotFound when there is none
+func (s *RedisStore) Get(ctx context.Context, key string) (Record, error) {
+	exists, err := cache.ExistsRedisData(ctx, otpKey(key))
+	if err != nil {
+		return Record{}, err
+	}
+	if !exists {
+		return Record{}, ErrCodeNotFound
+	}
+	return cache.GetRedisData[Record](ctx, otpKey(key))
+}
+
+// IncrementAttempts counts a check of the record and returns the number of checks
+func (s *RedisStore) IncrementAttempts(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	n, err := cache.IncrRedisData(ctx, otpAttemptsKey(key), ttl)
+	return int(n), err
+}
+
+// Delete removes the record and its attempts
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	if err := s.deleteAttempts(ctx, key); err != nil {
+		return err
+	}
+	exists, err := cache.ExistsRedisData(ctx, otpKey(key))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCodeNotFound
+	}
+	return cache.DeleteRedisData(ctx, otpKey(key))
+}
+
+func (s *RedisStore) deleteAttempts(ctx context.Context, key string) error {
+	exists, err := cache.ExistsRedisData(ctx, otpAttemptsKey(key))
+	if err != nil || !exists {
+		return err
+	}
+	return cache.DeleteRedisData(ctx, otpAttemptsKey(key))
+}
+
+// MemoryStore keeps the codes in process memory. It is meant for tests, expiry
+// is left to the Manager and its clock
+type MemoryStore struct {
+	mu       sync.Mutex
+	records  map[string]Record
+	attempts map[string]int
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records:  make(map[string]Record),
+		attempts: make(map[string]int),
+	}
+}
+
+// Save stores the record under key and resets its attempts
+func (s *MemoryStore) Save(_ context.Context, key string, record Record, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = record
+	delete(s.attempts, key)
+	return nil
+}
+
+// Get returns the record stored under key, ErrCodeNotFound when there is none
+func (s *MemoryStore) Get(_ context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if !ok {
+		return Record{}, ErrCodeNotFound
+	}
+	return record, nil
+}
+
+// IncrementAttempts counts a check of the record and returns the number of checks
+func (s *MemoryStore) IncrementAttempts(_ context.Context, key string, _ time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts[key]++
+	return s.attempts[key], nil
+}
+
+// Delete removes the record and its attempts
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[key]; !ok {
+		return ErrCodeNotFound
+	}
+	delete(s.records, key)
+	delete(s.attempts, key)
+	return nil
+}
@@ -21,6 +21,19 @@ func HandleError(c *gin.Context, status int, message string, err error) {
 	)
 }
 
+// HandleErrorCode is a helper function to handle an error with a machine-readable code
+// telling the client what to do, e.g. "step_up_required"
+func HandleErrorCode(c *gin.Context, status int, message string, code string, err error) {
+	logger.Error(message)
+	c.SecureJSON(
+		status, gin.H{
+			"message": message,
+			"success": false,
+			"code":    code,
+		},
+	)
+}
+
 // HandleSuccess is a helper function to handle a success
 func HandleSuccess(c *gin.Context, message string) {
 	c.SecureJSON(